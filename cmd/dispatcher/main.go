@@ -9,7 +9,6 @@ import (
 
 	lambdaevents "github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda"
@@ -86,13 +85,13 @@ func handleRequest(
 
 	if err := sender.Send(ctx, &enriched); err != nil {
 		logger.ErrorContext(ctx, "cannot send notification",
-			slog.String("alarmName", aws.ToString(enriched.Alarm.AlarmName)),
+			slog.String("alarmName", enriched.AlarmName()),
 			slog.String("error", err.Error()))
 		return err
 	}
 
 	logger.InfoContext(ctx, "notification sent",
-		slog.String("alarmName", aws.ToString(enriched.Alarm.AlarmName)))
+		slog.String("alarmName", enriched.AlarmName()))
 
 	return nil
 }
@@ -4,29 +4,66 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"time"
 
-	"github.com/aws/aws-lambda-go/events"
+	lambdaevents "github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 
 	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/alarm"
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/awsclient"
 	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/env"
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/links"
 	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/publish"
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/snapshot"
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/state"
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/tags"
 	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/telemetry"
 )
 
+// fallbackTimeout bounds publishing a fallback event. Enrichment ends that long before the Lambda
+// deadline, so that an enrichment running out of time, e.g. retrying throttled CloudWatch calls,
+// still leaves time to publish the fallback.
+const fallbackTimeout = 5 * time.Second
+
 func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
 	eventBusName := env.Get("EVENT_BUS_NAME", "default", env.ParseNonEmptyString)
+	roleARNTemplate := env.Get("CROSS_ACCOUNT_ROLE_ARN", "", env.ParseString)
+	tagKeys := env.Get("RESOURCE_TAG_KEYS", tags.DefaultKeys, env.ParseStringList)
+	includeHistory := env.Get("INCLUDE_HISTORY", false, env.ParseBool)
+	historyLookback := env.Get("HISTORY_LOOKBACK", time.Hour, env.ParseDuration)
+	maxViolatingMetrics := env.Get("MAX_VIOLATING_METRICS", int64(50), env.ParseInt)
+	metricDataConcurrency := env.Get("METRIC_DATA_CONCURRENCY", int64(4), env.ParseInt)
+	metricDataTPS := env.Get("METRIC_DATA_TPS", int64(50), env.ParseInt)
+	listMetricsCacheTTL := env.Get("LIST_METRICS_CACHE_TTL", 5*time.Minute, env.ParseDuration)
+	maxCandidates := env.Get("MAX_CANDIDATES", int64(5000), env.ParseInt)
+	drillDownStrategy := env.Get("DRILL_DOWN_STRATEGY", alarm.DrillDownStrategy(alarm.MostDimensions{}), alarm.ParseDrillDownStrategy)
+	dimensionInclude := env.Get("DIMENSION_INCLUDE", []alarm.DimensionRule(nil), alarm.ParseDimensionRules)
+	dimensionExclude := env.Get("DIMENSION_EXCLUDE", []alarm.DimensionRule(nil), alarm.ParseDimensionRules)
+	alarmOverrides := env.Get("ALARM_OVERRIDES", false, env.ParseBool)
+	missingDataLookback := env.Get("MISSING_DATA_LOOKBACK", alarm.DefaultMissingDataLookback, env.ParseDuration)
+	snapshotBucket := env.Get("SNAPSHOT_BUCKET", "", env.ParseString)
+	snapshotPrefix := env.Get("SNAPSHOT_PREFIX", "snapshots/", env.ParseString)
+	snapshotDir := env.Get("SNAPSHOT_DIR", "", env.ParseString)
+	snapshotURLExpiry := env.Get("SNAPSHOT_URL_EXPIRY", time.Hour, env.ParseDuration)
+	stateTable := env.Get("STATE_TABLE", "", env.ParseString)
+	stateDir := env.Get("STATE_DIR", "", env.ParseString)
+	stateTTL := env.Get("STATE_TTL", 7*24*time.Hour, env.ParseDuration)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -39,7 +76,80 @@ func main() {
 
 	otelaws.AppendMiddlewares(&awsCfg.APIOptions)
 
-	enricher := alarm.NewMetricAlarmEnricher(cloudwatch.NewFromConfig(awsCfg), logger)
+	stsClient := sts.NewFromConfig(awsCfg)
+
+	// The home account is only needed to tell which alarms require assuming a role.
+	var homeAccountID string
+	if roleARNTemplate != "" {
+		identity, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			logger.Error("cannot get caller identity", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		homeAccountID = aws.ToString(identity.Account)
+	}
+
+	pool := awsclient.NewPool(awsCfg, stsClient, homeAccountID, roleARNTemplate)
+	cwClients := awsclient.NewClients(pool, func(cfg aws.Config) alarm.CloudWatchAPI {
+		return cloudwatch.NewFromConfig(cfg)
+	})
+
+	opts := []alarm.Option{
+		alarm.WithClientProvider(cwClients),
+		alarm.WithMaxViolatingMetrics(int(maxViolatingMetrics)),
+		alarm.WithMissingDataLookback(missingDataLookback),
+		alarm.WithConcurrency(int(metricDataConcurrency)),
+		alarm.WithRateLimit(float64(metricDataTPS), int(metricDataConcurrency)),
+		alarm.WithMaxCandidates(int(maxCandidates)),
+		alarm.WithDrillDownStrategy(drillDownStrategy),
+		alarm.WithDimensionFilter(dimensionInclude, dimensionExclude),
+	}
+	if len(tagKeys) > 0 {
+		taggingClients := awsclient.NewClients(pool, func(cfg aws.Config) tags.TaggingAPI {
+			return resourcegroupstaggingapi.NewFromConfig(cfg)
+		})
+		opts = append(opts, alarm.WithTagResolver(tags.NewResolver(taggingClients, awsCfg.Region, tagKeys)))
+	}
+
+	if listMetricsCacheTTL > 0 {
+		opts = append(opts, alarm.WithMetricCache(alarm.NewTTLCache(listMetricsCacheTTL, nil)))
+	}
+
+	if alarmOverrides {
+		opts = append(opts, alarm.WithAlarmOverrides())
+	}
+
+	if includeHistory {
+		opts = append(opts, alarm.WithHistory(historyLookback))
+	}
+
+	enricher := alarm.NewMetricAlarmEnricher(cloudwatch.NewFromConfig(awsCfg), logger, opts...)
+	var snapshotStore snapshot.Store
+	switch {
+	case snapshotBucket != "":
+		s3Client := s3.NewFromConfig(awsCfg)
+		snapshotStore = snapshot.NewS3Store(s3Client, s3.NewPresignClient(s3Client), awsCfg.Credentials,
+			snapshotBucket, snapshotPrefix, snapshotURLExpiry)
+	case snapshotDir != "":
+		snapshotStore = snapshot.NewFileStore(snapshotDir)
+	}
+
+	var snapshotter *snapshot.Snapshotter
+	if snapshotStore != nil {
+		widgetClients := awsclient.NewClients(pool, func(cfg aws.Config) snapshot.WidgetAPI {
+			return cloudwatch.NewFromConfig(cfg)
+		})
+		snapshotter = snapshot.NewSnapshotter(widgetClients, snapshotStore, snapshot.DefaultTopN)
+	}
+
+	var tracker *state.Tracker
+	switch {
+	case stateTable != "":
+		tracker = state.NewTracker(state.NewDynamoStore(dynamodb.NewFromConfig(awsCfg), stateTable, stateTTL))
+	case stateDir != "":
+		tracker = state.NewTracker(state.NewFileStore(stateDir))
+	}
+
 	publisher := publish.NewPublisher(eventbridge.NewFromConfig(awsCfg), eventBusName)
 
 	tp, err := telemetry.NewTracerProvider(ctx)
@@ -57,10 +167,19 @@ func main() {
 		}
 	}()
 
-	logger.Info("started enricher", slog.String("eventBus", eventBusName))
+	logger.Info("started enricher",
+		slog.String("eventBus", eventBusName),
+		slog.String("crossAccountRoleARN", roleARNTemplate),
+		slog.Any("resourceTagKeys", tagKeys),
+		slog.String("drillDownStrategy", drillDownStrategy.String()),
+		slog.String("dimensionInclude", fmt.Sprint(dimensionInclude)),
+		slog.String("dimensionExclude", fmt.Sprint(dimensionExclude)),
+		slog.Bool("alarmOverrides", alarmOverrides),
+		slog.Bool("snapshots", snapshotter != nil),
+		slog.Bool("stateTracking", tracker != nil))
 
-	handler := func(ctx context.Context, event events.CloudWatchEvent) error {
-		return handleRequest(ctx, event, enricher, publisher, logger)
+	handler := func(ctx context.Context, event lambdaevents.CloudWatchEvent) error {
+		return handleRequest(ctx, event, enricher, tracker, snapshotter, publisher, awsCfg.Region, logger)
 	}
 
 	lambda.Start(
@@ -73,14 +192,15 @@ func main() {
 
 func handleRequest(
 	ctx context.Context,
-	event events.CloudWatchEvent,
+	event lambdaevents.CloudWatchEvent,
 	enricher alarm.Enricher,
+	tracker *state.Tracker,
+	snapshotter *snapshot.Snapshotter,
 	publisher *publish.Publisher,
+	defaultRegion string,
 	logger *slog.Logger,
 ) error {
-	var detail struct {
-		AlarmName string `json:"alarmName"`
-	}
+	var detail events.AlarmStateChange
 
 	if err := json.Unmarshal(event.Detail, &detail); err != nil {
 		logger.ErrorContext(ctx, "cannot parse event detail", slog.String("error", err.Error()))
@@ -93,25 +213,143 @@ func handleRequest(
 		return err
 	}
 
-	enriched, err := enricher.Enrich(ctx, detail.AlarmName)
+	stateChangedAt := event.Time
+	if detail.State.Timestamp != "" {
+		t, err := detail.State.Time()
+		if err != nil {
+			logger.WarnContext(ctx, "cannot parse alarm state timestamp; using event time",
+				slog.String("timestamp", detail.State.Timestamp),
+				slog.String("error", err.Error()))
+		} else {
+			stateChangedAt = t
+		}
+	}
+
+	req := alarm.Request{
+		AlarmName:      detail.AlarmName,
+		AccountID:      event.AccountID,
+		Region:         event.Region,
+		StateChangedAt: stateChangedAt,
+		StateChange:    &detail,
+	}
+	if len(event.Resources) > 0 {
+		req.AlarmARN = event.Resources[0]
+	}
+
+	enrichCtx, cancel := enrichContext(ctx)
+	enriched, err := enricher.Enrich(enrichCtx, req)
+	cancel()
 	if err != nil {
-		logger.ErrorContext(ctx, "cannot enrich alarm",
+		logger.ErrorContext(ctx, "cannot enrich alarm; publishing fallback event",
 			slog.String("alarmName", detail.AlarmName),
 			slog.String("error", err.Error()))
-		return err
+
+		// The fallback is published even when the invocation's context is done.
+		fallbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fallbackTimeout)
+		defer cancel()
+
+		return publishFallback(fallbackCtx, alarm.FallbackEvent(req, err), tracker, publisher, defaultRegion, logger)
 	}
 
-	enriched.AccountID = event.AccountID
+	if enriched.Partial {
+		logger.WarnContext(ctx, "publishing partial enrichment; some resources could not be evaluated",
+			slog.String("alarmName", enriched.AlarmName()),
+			slog.Int("enrichmentErrors", len(enriched.EnrichmentErrors)))
+	}
+
+	var update *state.Update
+	if tracker != nil {
+		update, err = tracker.Track(ctx, enriched)
+		if err != nil {
+			logger.WarnContext(ctx, "cannot track violation state",
+				slog.String("alarmName", enriched.AlarmName()),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	links.Add(enriched, defaultRegion)
+
+	if snapshotter != nil {
+		if err := snapshotter.Attach(ctx, enriched); err != nil {
+			logger.WarnContext(ctx, "cannot attach graph snapshot",
+				slog.String("alarmName", enriched.AlarmName()),
+				slog.String("error", err.Error()))
+		}
+	}
 
 	if err := publisher.Publish(ctx, enriched); err != nil {
 		logger.ErrorContext(ctx, "cannot publish enriched event",
-			slog.String("alarmName", aws.ToString(enriched.Alarm.AlarmName)),
+			slog.String("alarmName", enriched.AlarmName()),
 			slog.String("error", err.Error()))
 		return err
 	}
 
 	logger.InfoContext(ctx, "enriched event published",
-		slog.String("alarmName", aws.ToString(enriched.Alarm.AlarmName)))
+		slog.String("alarmName", enriched.AlarmName()))
+
+	// Violations are saved only once the event is out, so that a retry classifies them the same way.
+	if tracker != nil {
+		if err := tracker.Save(ctx, update); err != nil {
+			logger.WarnContext(ctx, "cannot save violation state",
+				slog.String("alarmName", enriched.AlarmName()),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	return nil
+}
+
+// enrichContext returns the context enrichment runs in, ending fallbackTimeout before the deadline
+// of ctx, if any.
+func enrichContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-fallbackTimeout))
+}
+
+// publishFallback publishes the event of an alarm whose enrichment failed, so that responders are
+// notified of the alarm all the same. There are no resources to graph, and violation state is only
+// cleared when the alarm is back in OK state.
+func publishFallback(
+	ctx context.Context,
+	fallback *events.EnrichedEvent,
+	tracker *state.Tracker,
+	publisher *publish.Publisher,
+	defaultRegion string,
+	logger *slog.Logger,
+) error {
+	var update *state.Update
+	if tracker != nil {
+		var err error
+		update, err = tracker.Track(ctx, fallback)
+		if err != nil {
+			logger.WarnContext(ctx, "cannot track violation state",
+				slog.String("alarmName", fallback.AlarmName()),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	links.Add(fallback, defaultRegion)
+
+	if err := publisher.Publish(ctx, fallback); err != nil {
+		logger.ErrorContext(ctx, "cannot publish fallback event",
+			slog.String("alarmName", fallback.AlarmName()),
+			slog.String("error", err.Error()))
+		return err
+	}
+
+	logger.InfoContext(ctx, "fallback event published",
+		slog.String("alarmName", fallback.AlarmName()))
+
+	if tracker != nil {
+		if err := tracker.Save(ctx, update); err != nil {
+			logger.WarnContext(ctx, "cannot save violation state",
+				slog.String("alarmName", fallback.AlarmName()),
+				slog.String("error", err.Error()))
+		}
+	}
 
 	return nil
 }
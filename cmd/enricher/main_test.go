@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	lambdaevents "github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/alarm"
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/publish"
+)
+
+// blockingEnricher stands for an enrichment that keeps retrying throttled calls until its context
+// is done.
+type blockingEnricher struct{}
+
+func (blockingEnricher) Enrich(ctx context.Context, _ alarm.Request) (*events.EnrichedEvent, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// fakeEventBridge records the events put to it, failing like the SDK does on a done context.
+type fakeEventBridge struct {
+	inputs []*eventbridge.PutEventsInput
+}
+
+func (f *fakeEventBridge) PutEvents(
+	ctx context.Context,
+	input *eventbridge.PutEventsInput,
+	_ ...func(*eventbridge.Options),
+) (*eventbridge.PutEventsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.inputs = append(f.inputs, input)
+	return &eventbridge.PutEventsOutput{}, nil
+}
+
+func TestHandleRequest_PublishesFallbackWhenEnrichmentRunsOutOfTime(t *testing.T) {
+	detail, err := json.Marshal(events.AlarmStateChange{
+		AlarmName: "cpu-high",
+		State:     events.AlarmState{Value: "ALARM", Reason: "Threshold Crossed"},
+	})
+	require.NoError(t, err)
+
+	// The invocation leaves enrichment a moment before its share of the time runs out.
+	ctx, cancel := context.WithTimeout(context.Background(), fallbackTimeout+100*time.Millisecond)
+	defer cancel()
+
+	client := &fakeEventBridge{}
+	err = handleRequest(ctx, lambdaevents.CloudWatchEvent{Detail: detail}, blockingEnricher{}, nil, nil,
+		publish.NewPublisher(client, "alarms"), "eu-north-1", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	require.Len(t, client.inputs, 1)
+	require.Len(t, client.inputs[0].Entries, 1)
+
+	var published events.EnrichedEvent
+	require.NoError(t, json.Unmarshal([]byte(*client.inputs[0].Entries[0].Detail), &published))
+	assert.True(t, published.EnrichmentFailed())
+	assert.Contains(t, published.EnrichmentFailure, context.DeadlineExceeded.Error())
+}
+
+func TestHandleRequest_PublishesFallbackAfterDeadline(t *testing.T) {
+	detail, err := json.Marshal(events.AlarmStateChange{
+		AlarmName: "cpu-high",
+		State:     events.AlarmState{Value: "ALARM", Reason: "Threshold Crossed"},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	client := &fakeEventBridge{}
+	err = handleRequest(ctx, lambdaevents.CloudWatchEvent{Detail: detail}, blockingEnricher{}, nil, nil,
+		publish.NewPublisher(client, "alarms"), "eu-north-1", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	assert.Len(t, client.inputs, 1)
+}
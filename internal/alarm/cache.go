@@ -0,0 +1,123 @@
+package alarm
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// MetricCache caches the metrics discovered through ListMetrics, keyed by account, region,
+// namespace, metric name and dimension filters.
+type MetricCache interface {
+	// Get returns the cached metrics of key and whether there were any.
+	Get(ctx context.Context, key string) ([]types.Metric, bool, error)
+	// Put caches the metrics of key.
+	Put(ctx context.Context, key string, metrics []types.Metric) error
+}
+
+// TTLCache is an in-process MetricCache whose entries expire after a fixed time. It survives
+// across warm Lambda invocations. Misses can fall through to a shared cache, such as one backed
+// by a database, that is filled along with it.
+type TTLCache struct {
+	ttl    time.Duration
+	shared MetricCache
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	metrics []types.Metric
+	expires time.Time
+}
+
+// NewTTLCache creates a TTLCache keeping entries for ttl. shared may be nil.
+func NewTTLCache(ttl time.Duration, shared MetricCache) *TTLCache {
+	return &TTLCache{
+		ttl:     ttl,
+		shared:  shared,
+		now:     time.Now,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// Get returns the metrics of key cached in process, or else in the shared cache.
+func (c *TTLCache) Get(ctx context.Context, key string) ([]types.Metric, bool, error) {
+	now := c.now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && !now.Before(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if ok {
+		return entry.metrics, true, nil
+	}
+
+	if c.shared == nil {
+		return nil, false, nil
+	}
+
+	metrics, ok, err := c.shared.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	c.put(key, metrics, now)
+
+	return metrics, true, nil
+}
+
+// Put caches the metrics of key in process and in the shared cache.
+func (c *TTLCache) Put(ctx context.Context, key string, metrics []types.Metric) error {
+	c.put(key, metrics, c.now())
+
+	if c.shared == nil {
+		return nil
+	}
+
+	return c.shared.Put(ctx, key, metrics)
+}
+
+func (c *TTLCache) put(key string, metrics []types.Metric, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop expired entries so that alarms that stopped firing don't accumulate.
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = cacheEntry{metrics: metrics, expires: now.Add(c.ttl)}
+}
+
+// metricCacheKey identifies a ListMetrics query in an account and region.
+func metricCacheKey(
+	accountID, region, namespace, metricName string,
+	dimensions []types.DimensionFilter,
+	recentlyActive bool,
+) string {
+	filters := make([]string, len(dimensions))
+	for i, d := range dimensions {
+		filters[i] = aws.ToString(d.Name) + "=" + aws.ToString(d.Value)
+	}
+	slices.Sort(filters)
+
+	key := strings.Join([]string{accountID, region, namespace, metricName, strings.Join(filters, ",")}, "|")
+	if recentlyActive {
+		key += "|" + string(types.RecentlyActivePt3h)
+	}
+
+	return key
+}
@@ -0,0 +1,71 @@
+package alarm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTLCache_Expires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC)
+
+	cache := NewTTLCache(5*time.Minute, nil)
+	cache.now = func() time.Time { return now }
+
+	metrics := []types.Metric{newMetric("CPUUtilization", "AWS/EC2", nil)}
+	require.NoError(t, cache.Put(ctx, "key", metrics))
+
+	now = now.Add(4 * time.Minute)
+	got, ok, err := cache.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, metrics, got)
+
+	now = now.Add(time.Minute)
+	_, ok, err = cache.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestTTLCache_FallsThroughToShared(t *testing.T) {
+	ctx := context.Background()
+
+	shared := NewTTLCache(time.Hour, nil)
+	metrics := []types.Metric{newMetric("CPUUtilization", "AWS/EC2", nil)}
+	require.NoError(t, shared.Put(ctx, "key", metrics))
+
+	cache := NewTTLCache(time.Minute, shared)
+	got, ok, err := cache.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, metrics, got)
+
+	require.NoError(t, cache.Put(ctx, "other", metrics))
+	_, ok, err = shared.Get(ctx, "other")
+	require.NoError(t, err)
+	assert.True(t, ok, "puts are written through to the shared cache")
+}
+
+func TestMetricCacheKey_IgnoresFilterOrder(t *testing.T) {
+	a := []types.DimensionFilter{
+		{Name: aws.String("InstanceId"), Value: aws.String("i-a")},
+		{Name: aws.String("AutoScalingGroupName")},
+	}
+	b := []types.DimensionFilter{a[1], a[0]}
+
+	assert.Equal(t,
+		metricCacheKey("111111111111", "eu-north-1", "AWS/EC2", "CPUUtilization", a, false),
+		metricCacheKey("111111111111", "eu-north-1", "AWS/EC2", "CPUUtilization", b, false))
+	assert.NotEqual(t,
+		metricCacheKey("111111111111", "eu-north-1", "AWS/EC2", "CPUUtilization", a, false),
+		metricCacheKey("222222222222", "eu-north-1", "AWS/EC2", "CPUUtilization", a, false))
+	assert.NotEqual(t,
+		metricCacheKey("111111111111", "eu-north-1", "AWS/EC2", "CPUUtilization", a, false),
+		metricCacheKey("111111111111", "eu-north-1", "AWS/EC2", "CPUUtilization", a, true))
+}
@@ -0,0 +1,147 @@
+package alarm
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// maxQueriesPerRequest is the GetMetricData limit on the number of queries per request.
+const maxQueriesPerRequest = 500
+
+// candidate is a single resource evaluated against the alarm threshold.
+// Its queries produce exactly one returned time series, identified by candidateQueryID.
+type candidate struct {
+	metric  *types.Metric
+	queries []types.MetricDataQuery
+}
+
+// candidateQueryID returns the ID of the query whose result is compared against the threshold
+// for the candidate at index idx.
+func candidateQueryID(idx int) string {
+	return "m" + strconv.Itoa(idx)
+}
+
+// batchQueries splits the candidates' queries into GetMetricData requests of at most size queries,
+// never splitting a single candidate's queries across requests.
+func batchQueries(candidates []candidate, size int) [][]types.MetricDataQuery {
+	var (
+		batches [][]types.MetricDataQuery
+		current []types.MetricDataQuery
+	)
+
+	for _, c := range candidates {
+		if len(current) > 0 && len(current)+len(c.queries) > size {
+			batches = append(batches, current)
+			current = nil
+		}
+		current = append(current, c.queries...)
+	}
+
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+
+	return batches
+}
+
+// alarmPeriod returns the evaluation period of the alarm. Alarms defined through metric queries
+// don't carry a top-level period, so the longest period among their queries is used.
+func alarmPeriod(alarm *types.MetricAlarm) time.Duration {
+	seconds := aws.ToInt32(alarm.Period)
+
+	for _, q := range alarm.Metrics {
+		if q.MetricStat != nil {
+			seconds = max(seconds, aws.ToInt32(q.MetricStat.Period))
+		}
+		seconds = max(seconds, aws.ToInt32(q.Period))
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// dimensionsMap returns dimensions keyed by name.
+func dimensionsMap(dimensions []types.Dimension) map[string]string {
+	m := make(map[string]string, len(dimensions))
+	for _, d := range dimensions {
+		m[aws.ToString(d.Name)] = aws.ToString(d.Value)
+	}
+	return m
+}
+
+func toDimensionFilters(dimensions []types.Dimension) []types.DimensionFilter {
+	filters := make([]types.DimensionFilter, 0, len(dimensions))
+	for _, d := range dimensions {
+		filters = append(filters, types.DimensionFilter{
+			Name:  d.Name,
+			Value: d.Value,
+		})
+	}
+	return filters
+}
+
+// dimensionKey returns a canonical representation of the dimensions not listed in exclude.
+func dimensionKey(dimensions []types.Dimension, exclude []types.Dimension) string {
+	parts := make([]string, 0, len(dimensions))
+	for _, d := range dimensions {
+		name := aws.ToString(d.Name)
+		if slices.ContainsFunc(exclude, func(x types.Dimension) bool { return aws.ToString(x.Name) == name }) {
+			continue
+		}
+		parts = append(parts, name+"="+aws.ToString(d.Value))
+	}
+
+	slices.Sort(parts)
+	return strings.Join(parts, ",")
+}
+
+// bandQueryID returns the ID of the anomaly detection band query for the candidate at index idx.
+func bandQueryID(idx int) string {
+	return "b" + strconv.Itoa(idx)
+}
+
+// parseCandidateQueryID returns the candidate index encoded in a returned query ID and whether
+// the query is the candidate's anomaly detection band.
+func parseCandidateQueryID(id string) (int, bool, error) {
+	var (
+		digits string
+		isBand bool
+	)
+
+	switch {
+	case strings.HasPrefix(id, "m"):
+		digits = strings.TrimPrefix(id, "m")
+	case strings.HasPrefix(id, "b"):
+		digits, isBand = strings.TrimPrefix(id, "b"), true
+	default:
+		return 0, false, fmt.Errorf("cannot parse metric id %q: unknown prefix", id)
+	}
+
+	idx, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, false, fmt.Errorf("cannot parse metric id %q: %w", id, err)
+	}
+
+	return idx, isBand, nil
+}
+
+// alarmNamespace returns the namespace of the metric an alarm watches; for metric math alarms,
+// the namespace of the first metric in the expression.
+func alarmNamespace(alarm *types.MetricAlarm) string {
+	if alarm.Namespace != nil {
+		return aws.ToString(alarm.Namespace)
+	}
+
+	for _, q := range alarm.Metrics {
+		if q.MetricStat != nil && q.MetricStat.Metric != nil {
+			return aws.ToString(q.MetricStat.Metric.Namespace)
+		}
+	}
+
+	return ""
+}
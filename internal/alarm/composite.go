@@ -0,0 +1,180 @@
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// maxAlarmNamesPerDescribe is the DescribeAlarms limit on the number of alarm names per request.
+const maxAlarmNamesPerDescribe = 100
+
+// enrichCompositeAlarm resolves the child alarms referenced by a composite alarm rule that are currently
+// in ALARM state and enriches each of them over the window ending at the composite alarm's transition.
+// Nested composite alarms are resolved recursively; visited guards against enriching the same alarm
+// twice, so that a child referenced by several composite alarms in the tree is enriched and listed
+// only where it is first reached. A child that cannot be enriched is reported with the error and the
+// others are still enriched, unless the error would fail them all.
+func (e *MetricAlarmEnricher) enrichCompositeAlarm(
+	ctx context.Context,
+	composite *types.CompositeAlarm,
+	at time.Time,
+	visited map[string]bool,
+) ([]events.ChildAlarm, error) {
+	alarmName := aws.ToString(composite.AlarmName)
+
+	ctx, span := tracer.Start(ctx, "alarm.enrich_composite")
+	defer span.End()
+	span.SetAttributes(attribute.String("alarm.name", alarmName))
+
+	if composite.StateValue != types.StateValueAlarm {
+		e.logger.InfoContext(
+			ctx,
+			"composite alarm not in ALARM state; skipping child alarm analysis",
+			slog.String("alarmName", alarmName),
+			slog.String("state", string(composite.StateValue)),
+		)
+		return []events.ChildAlarm{}, nil
+	}
+
+	childNames := parseAlarmRule(aws.ToString(composite.AlarmRule))
+	span.SetAttributes(attribute.Int("alarm.child_count", len(childNames)))
+
+	if len(childNames) == 0 {
+		e.logger.WarnContext(ctx, "composite alarm rule references no alarms",
+			slog.String("alarmName", alarmName),
+			slog.String("alarmRule", aws.ToString(composite.AlarmRule)))
+		return []events.ChildAlarm{}, nil
+	}
+
+	metricAlarms, compositeAlarms, err := e.describeAlarmsInAlarmState(ctx, childNames)
+	if err != nil {
+		return nil, fmt.Errorf("cannot describe child alarms of %q: %w", alarmName, err)
+	}
+
+	// Keep the order in which the children appear in the rule.
+	children := []events.ChildAlarm{}
+	for _, name := range childNames {
+		if visited[name] {
+			continue
+		}
+
+		if child, ok := metricAlarms[name]; ok {
+			visited[name] = true
+
+			analysis, err := e.enrichMetricAlarm(ctx, child, at)
+			if isFatal(err) {
+				return nil, err
+			}
+			if err != nil {
+				children = append(children, e.failedChild(ctx, events.ChildAlarm{Alarm: child}, err))
+				continue
+			}
+
+			children = append(children, events.ChildAlarm{
+				Alarm:                   child,
+				EvaluationWindow:        analysis.window,
+				ViolatingMetrics:        analysis.violating,
+				OmittedViolatingMetrics: analysis.omitted,
+				Summary:                 analysis.summary,
+				EnrichmentErrors:        analysis.errors,
+			})
+			continue
+		}
+
+		if child, ok := compositeAlarms[name]; ok {
+			visited[name] = true
+
+			grandchildren, err := e.enrichCompositeAlarm(ctx, child, at, visited)
+			if isFatal(err) {
+				return nil, err
+			}
+			if err != nil {
+				children = append(children, e.failedChild(ctx, events.ChildAlarm{CompositeAlarm: child}, err))
+				continue
+			}
+
+			children = append(children, events.ChildAlarm{
+				CompositeAlarm: child,
+				ChildAlarms:    grandchildren,
+			})
+		}
+	}
+
+	return children, nil
+}
+
+// failedChild records the error that failed the enrichment of a child alarm.
+func (e *MetricAlarmEnricher) failedChild(ctx context.Context, child events.ChildAlarm, err error) events.ChildAlarm {
+	var name string
+	if child.Alarm != nil {
+		name = aws.ToString(child.Alarm.AlarmName)
+	} else {
+		name = aws.ToString(child.CompositeAlarm.AlarmName)
+	}
+
+	e.logger.WarnContext(ctx, "cannot enrich child alarm; reporting it without resources",
+		slog.String("alarmName", name),
+		slog.String("error", err.Error()))
+
+	child.EnrichmentErrors = []events.EnrichmentError{{
+		Reason:  events.EnrichmentAlarmFailed,
+		Message: err.Error(),
+	}}
+
+	return child
+}
+
+// describeAlarmsInAlarmState looks up the named alarms that are currently in ALARM state, keyed by name.
+// Names that don't resolve (e.g. alarms in other accounts) are silently omitted.
+func (e *MetricAlarmEnricher) describeAlarmsInAlarmState(
+	ctx context.Context,
+	names []string,
+) (map[string]*types.MetricAlarm, map[string]*types.CompositeAlarm, error) {
+	metricAlarms := make(map[string]*types.MetricAlarm)
+	compositeAlarms := make(map[string]*types.CompositeAlarm)
+
+	for i := 0; i < len(names); i += maxAlarmNamesPerDescribe {
+		end := min(i+maxAlarmNamesPerDescribe, len(names))
+
+		paginator := cloudwatch.NewDescribeAlarmsPaginator(e.cw, &cloudwatch.DescribeAlarmsInput{
+			AlarmNames: names[i:end],
+			AlarmTypes: []types.AlarmType{types.AlarmTypeMetricAlarm, types.AlarmTypeCompositeAlarm},
+			StateValue: types.StateValueAlarm,
+		})
+
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot describe alarms on next page: %w", err)
+			}
+
+			for j := range page.MetricAlarms {
+				metricAlarms[aws.ToString(page.MetricAlarms[j].AlarmName)] = &page.MetricAlarms[j]
+			}
+			for j := range page.CompositeAlarms {
+				compositeAlarms[aws.ToString(page.CompositeAlarms[j].AlarmName)] = &page.CompositeAlarms[j]
+			}
+		}
+	}
+
+	return metricAlarms, compositeAlarms, nil
+}
+
+// partialChildren reports whether some resources of any of the child alarms could not be evaluated.
+func partialChildren(children []events.ChildAlarm) bool {
+	for _, child := range children {
+		if len(child.EnrichmentErrors) > 0 || partialChildren(child.ChildAlarms) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package alarm
+
+import (
+	"cmp"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// recentlyActivePeriod is how far back ListMetrics looks when listing only recently active
+// metrics; it is the only period CloudWatch supports.
+const recentlyActivePeriod = 3 * time.Hour
+
+// discovery scopes the metric discovery of one evaluation of an alarm.
+type discovery struct {
+	// recentlyActive lists only the metrics that received data in the past three hours.
+	recentlyActive bool
+	// sampledOut counts the metrics the candidate cap left out; for metric math alarms, the most
+	// left out of any leg.
+	sampledOut int
+}
+
+// newDiscovery scopes the discovery of the metrics of alarm for an evaluation over window. Only
+// recently active metrics are listed when all the data queried is recent enough for metrics
+// without recent data to have none of it.
+func (e *MetricAlarmEnricher) newDiscovery(alarm *types.MetricAlarm, window events.TimeWindow) *discovery {
+	return &discovery{
+		recentlyActive: time.Since(e.queryStart(alarm, window)) <= recentlyActivePeriod,
+	}
+}
+
+// sample keeps at most maxCandidates of the metrics, chosen by a hash of their dimensions beyond
+// the filters, so that the same resources are kept across invocations and across the legs of a
+// metric math alarm. The metrics kept stay in order; it returns how many were left out.
+func (e *MetricAlarmEnricher) sample(metrics []*types.Metric, filters []types.DimensionFilter) ([]*types.Metric, int) {
+	if e.maxCandidates <= 0 || len(metrics) <= e.maxCandidates {
+		return metrics, 0
+	}
+
+	type ranked struct {
+		idx  int
+		hash uint64
+	}
+
+	ranks := make([]ranked, len(metrics))
+	for i, m := range metrics {
+		ranks[i] = ranked{idx: i, hash: sampleHash(m.Dimensions, filters)}
+	}
+	slices.SortFunc(ranks, func(a, b ranked) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.idx, b.idx))
+	})
+
+	keep := make(map[int]bool, e.maxCandidates)
+	for _, r := range ranks[:e.maxCandidates] {
+		keep[r.idx] = true
+	}
+
+	kept := make([]*types.Metric, 0, e.maxCandidates)
+	for _, idx := range slices.Sorted(maps.Keys(keep)) {
+		kept = append(kept, metrics[idx])
+	}
+
+	return kept, len(metrics) - len(kept)
+}
+
+// sampleHash hashes the dimensions not named by the filters, in canonical order.
+func sampleHash(dimensions []types.Dimension, filters []types.DimensionFilter) uint64 {
+	extra := dimensionsMap(dimensions)
+	for _, f := range filters {
+		delete(extra, aws.ToString(f.Name))
+	}
+
+	h := fnv.New64a()
+	for _, name := range slices.Sorted(maps.Keys(extra)) {
+		h.Write([]byte(name))
+		h.Write([]byte{'='})
+		h.Write([]byte(extra[name]))
+		h.Write([]byte{','})
+	}
+
+	return h.Sum64()
+}
@@ -0,0 +1,80 @@
+package alarm
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+func instanceMetrics(n int) []*types.Metric {
+	metrics := make([]*types.Metric, n)
+	for i := range metrics {
+		m := newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{
+			newDimension("AutoScalingGroupName", "web"),
+			newDimension("InstanceId", fmt.Sprintf("i-%04d", i)),
+		})
+		metrics[i] = &m
+	}
+	return metrics
+}
+
+func TestSample(t *testing.T) {
+	e := NewMetricAlarmEnricher(nil, slog.New(slog.NewTextHandler(io.Discard, nil)), WithMaxCandidates(10))
+	filters := []types.DimensionFilter{{Name: aws.String("AutoScalingGroupName"), Value: aws.String("web")}}
+
+	metrics := instanceMetrics(100)
+	sampled, sampledOut := e.sample(metrics, filters)
+	require.Len(t, sampled, 10)
+	assert.Equal(t, 90, sampledOut)
+
+	instances := dimensionValues(sampled, "InstanceId")
+	assert.True(t, slices.IsSorted(instances), "sampled metrics keep their order")
+
+	// The same resources are kept whatever order they are listed in.
+	reversed := slices.Clone(metrics)
+	slices.Reverse(reversed)
+	again, _ := e.sample(reversed, filters)
+	assert.ElementsMatch(t, instances, dimensionValues(again, "InstanceId"))
+
+	// Metric math legs drilled down to the same resources keep the same ones.
+	leg := instanceMetrics(100)
+	for _, m := range leg {
+		m.MetricName = aws.String("NetworkIn")
+	}
+	legSampled, _ := e.sample(leg, filters)
+	assert.Equal(t, instances, dimensionValues(legSampled, "InstanceId"))
+}
+
+func TestSample_UnderCap(t *testing.T) {
+	e := NewMetricAlarmEnricher(nil, slog.New(slog.NewTextHandler(io.Discard, nil)), WithMaxCandidates(10))
+
+	sampled, sampledOut := e.sample(instanceMetrics(10), nil)
+	assert.Len(t, sampled, 10)
+	assert.Zero(t, sampledOut)
+}
+
+func TestNewDiscovery_RecentlyActive(t *testing.T) {
+	e := NewMetricAlarmEnricher(nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	alarm := newMetricAlarm("cpu-high", "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+
+	recent := evaluationWindow(&alarm, time.Now())
+	assert.True(t, e.newDiscovery(&alarm, recent).recentlyActive)
+
+	old := events.TimeWindow{Start: time.Now().Add(-4 * time.Hour), End: time.Now().Add(-3 * time.Hour)}
+	assert.False(t, e.newDiscovery(&alarm, old).recentlyActive)
+
+	// History queried from before the past three hours needs metrics that since went quiet.
+	withHistory := NewMetricAlarmEnricher(nil, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithHistory(6*time.Hour))
+	assert.False(t, withHistory.newDiscovery(&alarm, recent).recentlyActive)
+}
@@ -0,0 +1,193 @@
+package alarm
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// DrillDownStrategy chooses which of the metrics listed for an alarm metric are evaluated as
+// its resources.
+type DrillDownStrategy interface {
+	// Select returns the metrics to evaluate among those listed for the alarm metric, whose own
+	// dimensions are filters. Every listed metric has at least the dimensions of filters.
+	Select(metrics []*types.Metric, filters []types.DimensionFilter) []*types.Metric
+	// String describes the strategy in the form ParseDrillDownStrategy accepts.
+	String() string
+}
+
+// MostDimensions selects the metrics with the most dimensions, the most detailed breakdown of the
+// alarm metric. It is the default strategy.
+type MostDimensions struct{}
+
+// Select returns the metrics with the most dimensions.
+func (MostDimensions) Select(metrics []*types.Metric, filters []types.DimensionFilter) []*types.Metric {
+	return mostDimensions(metrics, len(filters), -1)
+}
+
+func (MostDimensions) String() string {
+	return "most-dimensions"
+}
+
+// MaxDepth selects the metrics with the most dimensions among those with at most Depth dimensions
+// beyond the alarm's own.
+type MaxDepth struct {
+	Depth int
+}
+
+// Select returns the most detailed metrics within the depth.
+func (s MaxDepth) Select(metrics []*types.Metric, filters []types.DimensionFilter) []*types.Metric {
+	return mostDimensions(metrics, len(filters), len(filters)+s.Depth)
+}
+
+func (s MaxDepth) String() string {
+	return "max-depth:" + strconv.Itoa(s.Depth)
+}
+
+// TargetKeys selects the metrics broken down by Keys, preferring those with the fewest other
+// dimensions: for a Container Insights alarm on a cluster, keys ServiceName selects per-service
+// rather than per-pod metrics.
+type TargetKeys struct {
+	Keys []string
+}
+
+// Select returns the metrics with the fewest dimensions among those having all the keys.
+func (s TargetKeys) Select(metrics []*types.Metric, _ []types.DimensionFilter) []*types.Metric {
+	var (
+		selected []*types.Metric
+		fewest   int
+	)
+
+	for _, m := range metrics {
+		names := dimensionNames(m.Dimensions)
+		if !containsAll(names, s.Keys) {
+			continue
+		}
+
+		switch n := len(names); {
+		case selected == nil || n < fewest:
+			selected = []*types.Metric{m}
+			fewest = n
+		case n == fewest:
+			selected = append(selected, m)
+		}
+	}
+
+	return selected
+}
+
+func (s TargetKeys) String() string {
+	return "keys:" + strings.Join(s.Keys, "/")
+}
+
+// ExactDimensions selects the metrics whose dimensions are exactly the alarm's own plus Keys.
+// Without keys, only the alarm metric itself is evaluated.
+type ExactDimensions struct {
+	Keys []string
+}
+
+// Select returns the metrics with exactly the expected dimension names.
+func (s ExactDimensions) Select(metrics []*types.Metric, filters []types.DimensionFilter) []*types.Metric {
+	want := slices.Clone(s.Keys)
+	for _, f := range filters {
+		want = append(want, aws.ToString(f.Name))
+	}
+	slices.Sort(want)
+	want = slices.Compact(want)
+
+	var selected []*types.Metric
+	for _, m := range metrics {
+		names := dimensionNames(m.Dimensions)
+		slices.Sort(names)
+		if slices.Equal(names, want) {
+			selected = append(selected, m)
+		}
+	}
+
+	return selected
+}
+
+func (s ExactDimensions) String() string {
+	if len(s.Keys) == 0 {
+		return "exact"
+	}
+	return "exact:" + strings.Join(s.Keys, "/")
+}
+
+// ParseDrillDownStrategy parses a strategy from its description: "most-dimensions",
+// "max-depth:N", "keys:A/B" or "exact[:A/B]". Dimension names may be separated by slashes,
+// commas or spaces; alarm tag values can't hold commas.
+func ParseDrillDownStrategy(s string) (DrillDownStrategy, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(s), ":")
+	keys := strings.FieldsFunc(arg, func(r rune) bool {
+		return r == '/' || r == ',' || r == ' '
+	})
+
+	switch name {
+	case "", "most-dimensions":
+		return MostDimensions{}, nil
+	case "max-depth":
+		depth, err := strconv.Atoi(arg)
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid drill-down depth %q", arg)
+		}
+		return MaxDepth{Depth: depth}, nil
+	case "keys":
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("drill-down strategy %q names no dimensions", s)
+		}
+		return TargetKeys{Keys: keys}, nil
+	case "exact":
+		if len(keys) == 0 {
+			return ExactDimensions{}, nil
+		}
+		return ExactDimensions{Keys: keys}, nil
+	default:
+		return nil, fmt.Errorf("unknown drill-down strategy %q", s)
+	}
+}
+
+// mostDimensions returns the metrics with the most dimensions, at least least and, unless limit
+// is negative, at most limit.
+func mostDimensions(metrics []*types.Metric, least, limit int) []*types.Metric {
+	var selected []*types.Metric
+	most := least
+
+	for _, m := range metrics {
+		n := len(m.Dimensions)
+		if n < most || (limit >= 0 && n > limit) {
+			continue
+		}
+
+		// Metrics with more dimensions than previously seen provide richer detail.
+		if n > most {
+			selected = []*types.Metric{m}
+			most = n
+		} else {
+			selected = append(selected, m)
+		}
+	}
+
+	return selected
+}
+
+func dimensionNames(dimensions []types.Dimension) []string {
+	names := make([]string, len(dimensions))
+	for i, d := range dimensions {
+		names[i] = aws.ToString(d.Name)
+	}
+	return names
+}
+
+func containsAll(names, keys []string) bool {
+	for _, k := range keys {
+		if !slices.Contains(names, k) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package alarm
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// containerInsightsMetrics lists CPU metrics of a cluster at its cluster, service and pod levels.
+func containerInsightsMetrics() []*types.Metric {
+	cluster := newDimension("ClusterName", "prod")
+	service := func(name string) types.Dimension { return newDimension("Service", name) }
+	pod := func(name string) types.Dimension { return newDimension("FullPodName", name) }
+
+	metrics := []types.Metric{
+		newMetric("pod_cpu_utilization", "ContainerInsights", []types.Dimension{cluster}),
+		newMetric("pod_cpu_utilization", "ContainerInsights", []types.Dimension{cluster, service("api")}),
+		newMetric("pod_cpu_utilization", "ContainerInsights", []types.Dimension{cluster, service("web")}),
+		newMetric("pod_cpu_utilization", "ContainerInsights", []types.Dimension{cluster, service("api"), pod("api-1")}),
+		newMetric("pod_cpu_utilization", "ContainerInsights", []types.Dimension{cluster, service("api"), pod("api-2")}),
+		newMetric("pod_cpu_utilization", "ContainerInsights", []types.Dimension{cluster, service("web"), pod("web-1")}),
+	}
+
+	ptrs := make([]*types.Metric, len(metrics))
+	for i := range metrics {
+		ptrs[i] = &metrics[i]
+	}
+	return ptrs
+}
+
+func dimensionValues(metrics []*types.Metric, name string) []string {
+	var values []string
+	for _, m := range metrics {
+		values = append(values, dimensionsMap(m.Dimensions)[name])
+	}
+	return values
+}
+
+func TestDrillDownStrategies(t *testing.T) {
+	filters := []types.DimensionFilter{{Name: aws.String("ClusterName"), Value: aws.String("prod")}}
+
+	tests := []struct {
+		name     string
+		strategy DrillDownStrategy
+		want     []string
+		by       string
+	}{
+		{"most dimensions", MostDimensions{}, []string{"api-1", "api-2", "web-1"}, "FullPodName"},
+		{"max depth 1", MaxDepth{Depth: 1}, []string{"api", "web"}, "Service"},
+		{"max depth 0", MaxDepth{Depth: 0}, []string{"prod"}, "ClusterName"},
+		{"target keys", TargetKeys{Keys: []string{"Service"}}, []string{"api", "web"}, "Service"},
+		{"target keys of pods", TargetKeys{Keys: []string{"FullPodName"}}, []string{"api-1", "api-2", "web-1"}, "FullPodName"},
+		{"exact", ExactDimensions{}, []string{"prod"}, "ClusterName"},
+		{"exact with keys", ExactDimensions{Keys: []string{"Service"}}, []string{"api", "web"}, "Service"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := tt.strategy.Select(containerInsightsMetrics(), filters)
+			assert.Equal(t, tt.want, dimensionValues(selected, tt.by))
+		})
+	}
+}
+
+func TestTargetKeys_NoMatch(t *testing.T) {
+	selected := TargetKeys{Keys: []string{"Namespace"}}.Select(containerInsightsMetrics(), nil)
+	assert.Empty(t, selected)
+}
+
+func TestParseDrillDownStrategy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want DrillDownStrategy
+	}{
+		{"", MostDimensions{}},
+		{"most-dimensions", MostDimensions{}},
+		{"max-depth:2", MaxDepth{Depth: 2}},
+		{"keys:Service", TargetKeys{Keys: []string{"Service"}}},
+		{"keys:ClusterName/Service", TargetKeys{Keys: []string{"ClusterName", "Service"}}},
+		{"keys:ClusterName,Service", TargetKeys{Keys: []string{"ClusterName", "Service"}}},
+		{"exact", ExactDimensions{}},
+		{"exact:Service", ExactDimensions{Keys: []string{"Service"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDrillDownStrategy(tt.in)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			again, err := ParseDrillDownStrategy(got.String())
+			require.NoError(t, err)
+			assert.Equal(t, got, again)
+		})
+	}
+
+	for _, in := range []string{"keys", "max-depth:-1", "max-depth:x", "deepest"} {
+		_, err := ParseDrillDownStrategy(in)
+		assert.Error(t, err, in)
+	}
+}
@@ -3,29 +3,57 @@ package alarm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
-	"strconv"
-	"strings"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/smithy-go"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 
 	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
 )
 
 var tracer = otel.Tracer("github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/alarm")
 
+// DefaultMissingDataLookback is the default of WithMissingDataLookback.
+const DefaultMissingDataLookback = time.Hour
+
 // Enricher enriches CloudWatch alarm events with detailed metric analysis.
 // It identifies specific resources violating alarm thresholds by querying CloudWatch metrics.
 type Enricher interface {
 	// Enrich retrieves alarm details and identifies metrics currently violating the threshold.
 	// Returns an EnrichedEvent containing the alarm state and violating metrics.
-	Enrich(ctx context.Context, alarmName string) (*events.EnrichedEvent, error)
+	Enrich(ctx context.Context, req Request) (*events.EnrichedEvent, error)
+}
+
+// Request identifies the alarm state change to enrich.
+type Request struct {
+	AlarmName string
+	// AccountID and Region locate the alarm. When both are empty, or without a ClientProvider,
+	// the alarm is looked up with the enricher's default client.
+	AccountID string
+	Region    string
+	// StateChangedAt is when the alarm transitioned to its current state. The evaluation window is
+	// anchored at this time so that retries and delayed deliveries evaluate the same window that
+	// caused the transition. The zero value anchors the window at the time of enrichment.
+	StateChangedAt time.Time
+	// StateChange is the state change event detail, if available. When it carries the alarm
+	// configuration the alarm is not described again. Its state takes precedence over the one
+	// described, and it is passed on to the enriched event.
+	StateChange *events.AlarmStateChange
+	// AlarmARN is the ARN of the alarm, if known. Alarms rebuilt from the state change payload
+	// carry no ARN otherwise; it is needed to look up their tags.
+	AlarmARN string
 }
 
 // CloudWatchAPI defines the CloudWatch operations required for alarm enrichment.
@@ -44,68 +72,428 @@ type CloudWatchAPI interface {
 		ctx context.Context,
 		input *cloudwatch.ListMetricsInput,
 		optFns ...func(*cloudwatch.Options)) (*cloudwatch.ListMetricsOutput, error)
+
+	ListTagsForResource(
+		ctx context.Context,
+		input *cloudwatch.ListTagsForResourceInput,
+		optFns ...func(*cloudwatch.Options)) (*cloudwatch.ListTagsForResourceOutput, error)
+}
+
+// ClientProvider returns the CloudWatch client for the account and region an alarm lives in.
+// An empty account ID or region stands for the enricher's own.
+type ClientProvider interface {
+	Client(ctx context.Context, accountID, region string) (CloudWatchAPI, error)
+}
+
+// TagResolver attaches the tags of their resources to violating metrics of an alarm
+// in the given account, region and namespace. Metrics are updated in place.
+type TagResolver interface {
+	Resolve(ctx context.Context, accountID, region, namespace string, metrics []events.ViolatingMetric) error
 }
 
 // MetricAlarmEnricher implements the Enricher interface for CloudWatch metric alarms.
 type MetricAlarmEnricher struct {
-	cw     CloudWatchAPI
-	logger *slog.Logger
+	cw      CloudWatchAPI
+	clients ClientProvider
+	tags    TagResolver
+	logger  *slog.Logger
+
+	// history enables recording the datapoints of violating metrics, starting historyLookback
+	// before the evaluation window.
+	history         bool
+	historyLookback time.Duration
+
+	// maxViolatingMetrics caps the violating and silent metrics reported per alarm; 0 reports all.
+	maxViolatingMetrics int
+
+	// concurrency is the number of GetMetricData batches fetched at once, and limiters pace
+	// GetMetricData requests per account and region; nil leaves them unpaced. limiter is the one
+	// of the request's account and region.
+	concurrency int
+	limiters    *rateLimiters
+	limiter     *rate.Limiter
+
+	// metricCache caches ListMetrics discovery; nil lists metrics on every request.
+	metricCache MetricCache
+
+	// drillDownStrategy selects the metrics evaluated as the resources of an alarm, and
+	// dimensionFilter narrows them down.
+	drillDownStrategy DrillDownStrategy
+	dimensionFilter   dimensionFilter
+
+	// maxCandidates caps the resources evaluated per alarm metric; 0 evaluates all of them.
+	maxCandidates int
+
+	// alarmOverrides enables configuring single alarms through their tags.
+	alarmOverrides bool
+
+	// missingDataLookback is how far before the evaluation window metrics of alarms in
+	// INSUFFICIENT_DATA state are looked for datapoints, to tell which of them stopped reporting,
+	// and metrics of alarms ignoring missing data, to tell the state they keep.
+	missingDataLookback time.Duration
+
+	// accountID and region locate the alarm being enriched; set on the per-request copy.
+	accountID string
+	region    string
+}
+
+// Option configures a MetricAlarmEnricher.
+type Option func(*MetricAlarmEnricher)
+
+// WithClientProvider makes the enricher look alarms up in the account and region they live in,
+// using the client the provider returns for them.
+func WithClientProvider(clients ClientProvider) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.clients = clients
+	}
+}
+
+// WithTagResolver attaches resource tags to violating metrics.
+func WithTagResolver(tags TagResolver) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.tags = tags
+	}
+}
+
+// WithHistory records the datapoints of every violating metric over the evaluation window and
+// the lookback before it.
+func WithHistory(lookback time.Duration) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.history = true
+		e.historyLookback = lookback
+	}
+}
+
+// WithMaxViolatingMetrics reports only the n most severe violating metrics of an alarm and
+// counts the rest as omitted. n <= 0 reports all of them.
+func WithMaxViolatingMetrics(n int) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.maxViolatingMetrics = max(n, 0)
+	}
+}
+
+// WithConcurrency fetches up to n GetMetricData batches of an alarm at once. n < 1 fetches them
+// one at a time.
+func WithConcurrency(n int) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.concurrency = max(n, 1)
+	}
+}
+
+// WithRateLimit paces GetMetricData requests to tps per second on average, with bursts of up to
+// burst requests, to stay within CloudWatch quotas. Each account and region is paced on its own,
+// as quotas apply to each. tps <= 0 leaves them unpaced.
+func WithRateLimit(tps float64, burst int) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.limiters = nil
+		if tps > 0 {
+			e.limiters = newRateLimiters(tps, burst)
+		}
+	}
+}
+
+// WithMetricCache caches the metrics discovered through ListMetrics in cache.
+func WithMetricCache(cache MetricCache) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.metricCache = cache
+	}
+}
+
+// WithDrillDownStrategy sets how alarm metrics are drilled down to the resources evaluated.
+// MostDimensions is the default.
+func WithDrillDownStrategy(strategy DrillDownStrategy) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.drillDownStrategy = strategy
+	}
+}
+
+// WithDimensionFilter evaluates only the resources whose dimensions match the include rules and
+// none of the exclude rules. Include rules on the same dimension are alternatives; those on
+// different dimensions must all match.
+func WithDimensionFilter(include, exclude []DimensionRule) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.dimensionFilter = dimensionFilter{include: include, exclude: exclude}
+	}
+}
+
+// WithMaxCandidates evaluates at most n of the resources an alarm metric is drilled down to, or of
+// the groups a Metrics Insights query returns, a sample that stays the same across invocations.
+// n <= 0 evaluates all of them.
+func WithMaxCandidates(n int) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.maxCandidates = max(n, 0)
+	}
+}
+
+// WithAlarmOverrides lets alarms override the enricher's configuration through their tags. It
+// costs a ListTagsForResource request per alarm.
+func WithAlarmOverrides() Option {
+	return func(e *MetricAlarmEnricher) {
+		e.alarmOverrides = true
+	}
+}
+
+// WithMissingDataLookback sets how far before the evaluation window of an alarm in
+// INSUFFICIENT_DATA state a metric must have reported to count as having stopped reporting. For
+// alarms that ignore missing data, it is how far back the state of a metric without data in the
+// evaluation window is looked for.
+func WithMissingDataLookback(lookback time.Duration) Option {
+	return func(e *MetricAlarmEnricher) {
+		e.missingDataLookback = lookback
+	}
 }
 
 // NewMetricAlarmEnricher creates a new MetricAlarmEnricher instance.
+// cw is the default client, used for requests that don't name an account.
 func NewMetricAlarmEnricher(
 	cw CloudWatchAPI,
 	logger *slog.Logger,
+	opts ...Option,
 ) *MetricAlarmEnricher {
-	return &MetricAlarmEnricher{
-		cw:     cw,
-		logger: logger,
+	e := &MetricAlarmEnricher{
+		cw:                  cw,
+		logger:              logger,
+		concurrency:         1,
+		drillDownStrategy:   MostDimensions{},
+		missingDataLookback: DefaultMissingDataLookback,
 	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
 }
 
 // Enrich retrieves the alarm details and identifies metrics currently violating the threshold.
-// It queries CloudWatch to find the most detailed metrics (those with the most dimensions)
-// and determines which specific resources are in violation.
-func (e *MetricAlarmEnricher) Enrich(ctx context.Context, alarmName string) (*events.EnrichedEvent, error) {
+// It queries CloudWatch for the metrics the drill-down strategy selects, by default the most
+// detailed ones (those with the most dimensions), and determines which specific resources are
+// in violation.
+// Composite alarms are resolved through their rule into the child alarms currently in ALARM state.
+// Transitions from ALARM to OK state are enriched with the incident they end and, for metric
+// alarms, the resources it resolved.
+func (e *MetricAlarmEnricher) Enrich(ctx context.Context, req Request) (*events.EnrichedEvent, error) {
+	alarmName := req.AlarmName
+
 	ctx, span := tracer.Start(ctx, "alarm.enrich")
 	defer span.End()
-	span.SetAttributes(attribute.String("alarm.name", alarmName))
+	span.SetAttributes(
+		attribute.String("alarm.name", alarmName),
+		attribute.String("alarm.account_id", req.AccountID),
+		attribute.String("alarm.region", req.Region),
+	)
 
-	output, err := e.cw.DescribeAlarms(ctx, &cloudwatch.DescribeAlarmsInput{
-		AlarmNames: []string{alarmName},
-		MaxRecords: aws.Int32(1),
-	})
+	cw := e.cw
+	if (req.AccountID != "" || req.Region != "") && e.clients != nil {
+		var err error
+		cw, err = e.clients.Client(ctx, req.AccountID, req.Region)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get cloudwatch client for account %s in %s: %w",
+				req.AccountID, req.Region, err)
+		}
+	}
+	e = e.forRequest(cw, req)
+
+	now := time.Now()
+	at := req.StateChangedAt
+	if at.IsZero() {
+		at = now
+	}
+
+	alarm, composite, err := e.describeAlarm(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("cannot describe alarm %q: %w", alarmName, err)
+		return nil, err
 	}
 
-	if len(output.MetricAlarms) == 0 {
-		return nil, fmt.Errorf("alarm %q not found", alarmName)
+	if req.AlarmARN != "" {
+		switch {
+		case alarm != nil && alarm.AlarmArn == nil:
+			alarm.AlarmArn = aws.String(req.AlarmARN)
+		case composite != nil && composite.AlarmArn == nil:
+			composite.AlarmArn = aws.String(req.AlarmARN)
+		}
 	}
 
-	alarm := &output.MetricAlarms[0]
+	applyStateChange(alarm, composite, req.StateChange)
 
 	event := &events.EnrichedEvent{
-		Alarm:            alarm,
-		Timestamp:        time.Now(),
+		AccountID:        req.AccountID,
+		Region:           req.Region,
+		Timestamp:        now,
+		StateChange:      req.StateChange,
 		ViolatingMetrics: []events.ViolatingMetric{},
+		Recovery:         e.recovery(ctx, req, at),
+	}
+
+	if event.Recovery != nil {
+		span.SetAttributes(attribute.Bool("alarm.recovery", true))
+	}
+
+	switch {
+	case alarm != nil:
+		event.Alarm = alarm
+
+		var analysis *metricAnalysis
+		if event.Recovery != nil {
+			analysis, err = e.enrichRecovery(ctx, alarm, event.Recovery)
+		} else {
+			analysis, err = e.enrichMetricAlarm(ctx, alarm, at)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		event.EvaluationWindow = analysis.window
+		event.ViolatingMetrics = analysis.violating
+		event.OmittedViolatingMetrics = analysis.omitted
+		event.Summary = analysis.summary
+		event.SilentMetrics = analysis.silent
+		event.OmittedSilentMetrics = analysis.omittedSilent
+		event.EnrichmentErrors = analysis.errors
+	case composite != nil:
+		event.CompositeAlarm = composite
+		span.SetAttributes(attribute.Bool("alarm.composite", true))
+
+		children, err := e.enrichCompositeAlarm(ctx, composite, at, map[string]bool{alarmName: true})
+		if err != nil {
+			return nil, err
+		}
+
+		event.ChildAlarms = children
+	default:
+		return nil, fmt.Errorf("alarm %q not found", alarmName)
+	}
+
+	event.Partial = len(event.EnrichmentErrors) > 0 || partialChildren(event.ChildAlarms)
+	span.SetAttributes(attribute.Bool("alarm.partial", event.Partial))
+
+	return event, nil
+}
+
+// forRequest returns a copy of the enricher scoped to the request's account and region
+// that makes its CloudWatch calls with cw.
+func (e *MetricAlarmEnricher) forRequest(cw CloudWatchAPI, req Request) *MetricAlarmEnricher {
+	scoped := *e
+	scoped.cw = cw
+	scoped.accountID = req.AccountID
+	scoped.region = req.Region
+	if e.limiters != nil {
+		scoped.limiter = e.limiters.limiter(req.AccountID, req.Region)
+	}
+	return &scoped
+}
+
+// describeAlarm returns the alarm to enrich, rebuilt from the state change payload when it carries
+// the alarm configuration and described through CloudWatch otherwise. Exactly one of the returned
+// alarms is set unless the alarm doesn't exist.
+func (e *MetricAlarmEnricher) describeAlarm(
+	ctx context.Context,
+	req Request,
+) (*types.MetricAlarm, *types.CompositeAlarm, error) {
+	span := trace.SpanFromContext(ctx)
+
+	if alarm, composite, ok := alarmFromStateChange(req.StateChange); ok {
+		span.SetAttributes(attribute.Bool("alarm.from_payload", true))
+		return alarm, composite, nil
+	}
+
+	span.SetAttributes(attribute.Bool("alarm.from_payload", false))
+
+	output, err := e.cw.DescribeAlarms(ctx, &cloudwatch.DescribeAlarmsInput{
+		AlarmNames: []string{req.AlarmName},
+		AlarmTypes: []types.AlarmType{types.AlarmTypeMetricAlarm, types.AlarmTypeCompositeAlarm},
+		MaxRecords: aws.Int32(1),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot describe alarm %q: %w", req.AlarmName, err)
 	}
 
-	if alarm.StateValue != types.StateValueAlarm {
+	switch {
+	case len(output.MetricAlarms) > 0:
+		return &output.MetricAlarms[0], nil, nil
+	case len(output.CompositeAlarms) > 0:
+		return nil, &output.CompositeAlarms[0], nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// metricAnalysis is the outcome of analyzing a metric alarm: its evaluation window, the
+// violating and silent metrics reported, most relevant first, along with how many more were left
+// out, and the summary of all the resources evaluated.
+type metricAnalysis struct {
+	window        *events.TimeWindow
+	violating     []events.ViolatingMetric
+	omitted       int
+	silent        []events.ViolatingMetric
+	omittedSilent int
+	summary       *events.ImpactSummary
+	// errors records the resources that could not be evaluated.
+	errors []events.EnrichmentError
+}
+
+// enrichMetricAlarm analyzes the resources covered by a metric alarm. For alarms in ALARM state
+// it finds the metrics violating the threshold, ranks them by severity and keeps the most severe
+// ones; for alarms in INSUFFICIENT_DATA state it finds the metrics that stopped reporting.
+// Alarms in other states are not analyzed.
+func (e *MetricAlarmEnricher) enrichMetricAlarm(
+	ctx context.Context,
+	alarm *types.MetricAlarm,
+	at time.Time,
+) (*metricAnalysis, error) {
+	alarmName := aws.ToString(alarm.AlarmName)
+
+	if alarm.StateValue != types.StateValueAlarm && alarm.StateValue != types.StateValueInsufficientData {
 		e.logger.InfoContext(
 			ctx,
-			"alarm not in ALARM state; skipping violation analysis",
+			"alarm not in ALARM or INSUFFICIENT_DATA state; skipping analysis",
 			slog.String("alarmName", alarmName),
 			slog.String("state", string(alarm.StateValue)),
 		)
-		return event, nil
+		return &metricAnalysis{violating: []events.ViolatingMetric{}}, nil
 	}
 
-	violatingMetrics, err := e.findViolatingMetrics(ctx, alarm)
+	e = e.forAlarm(ctx, alarm)
+	window := evaluationWindow(alarm, at)
+
+	found, err := e.findViolatingMetrics(ctx, alarm, window)
 	if err != nil {
 		return nil, fmt.Errorf("cannot find violating metrics for alarm %q: %w", alarmName, err)
 	}
 
+	summary := found.summary()
+
+	e.logger.InfoContext(
+		ctx,
+		"evaluated alarm candidates",
+		slog.String("alarmName", alarmName),
+		slog.Int("candidates", summary.Candidates),
+		slog.Int("violating", summary.Violating),
+		slog.Int("healthy", summary.Healthy),
+		slog.Int("noData", summary.NoData),
+		slog.Int("incomplete", summary.Incomplete),
+		slog.Int("failed", summary.Failed),
+	)
+
+	if alarm.StateValue == types.StateValueInsufficientData {
+		silent, omitted := e.truncate(rankSilentMetrics(found.silent))
+		e.resolveTags(ctx, alarm, silent)
+
+		return &metricAnalysis{
+			window:        &window,
+			violating:     []events.ViolatingMetric{},
+			silent:        silent,
+			omittedSilent: omitted,
+			summary:       summary,
+			errors:        found.errors,
+		}, nil
+	}
+
+	violatingMetrics := found.violating
+	if violatingMetrics == nil {
+		violatingMetrics = []events.ViolatingMetric{}
+	}
+
 	if len(violatingMetrics) == 0 {
 		e.logger.WarnContext(
 			ctx,
@@ -116,48 +504,243 @@ func (e *MetricAlarmEnricher) Enrich(ctx context.Context, alarmName string) (*ev
 		)
 	}
 
-	event.ViolatingMetrics = violatingMetrics
+	rankViolatingMetrics(alarm, violatingMetrics)
+	violatingMetrics, omitted := e.truncate(violatingMetrics)
 
-	return event, nil
+	e.resolveTags(ctx, alarm, violatingMetrics)
+
+	return &metricAnalysis{
+		window:    &window,
+		violating: violatingMetrics,
+		omitted:   omitted,
+		summary:   summary,
+		errors:    found.errors,
+	}, nil
 }
 
-func (e *MetricAlarmEnricher) findViolatingMetrics(ctx context.Context, alarm *types.MetricAlarm) ([]events.ViolatingMetric, error) {
-	dimensionFilters := make([]types.DimensionFilter, 0, len(alarm.Dimensions))
-	for _, d := range alarm.Dimensions {
-		dimensionFilters = append(dimensionFilters, types.DimensionFilter{
-			Name:  d.Name,
-			Value: d.Value,
-		})
+// truncate keeps the first maxViolatingMetrics metrics and returns how many were left out.
+func (e *MetricAlarmEnricher) truncate(metrics []events.ViolatingMetric) ([]events.ViolatingMetric, int) {
+	if e.maxViolatingMetrics <= 0 || len(metrics) <= e.maxViolatingMetrics {
+		return metrics, 0
 	}
 
+	return metrics[:e.maxViolatingMetrics], len(metrics) - e.maxViolatingMetrics
+}
+
+// resolveTags attaches resource tags to the violating metrics of an alarm. Tags are informational,
+// so failing to resolve them is logged rather than failing the enrichment.
+func (e *MetricAlarmEnricher) resolveTags(ctx context.Context, alarm *types.MetricAlarm, metrics []events.ViolatingMetric) {
+	if e.tags == nil || len(metrics) == 0 {
+		return
+	}
+
+	if err := e.tags.Resolve(ctx, e.accountID, e.region, alarmNamespace(alarm), metrics); err != nil {
+		e.logger.WarnContext(ctx, "cannot resolve resource tags",
+			slog.String("alarmName", aws.ToString(alarm.AlarmName)),
+			slog.String("error", err.Error()))
+	}
+}
+
+func (e *MetricAlarmEnricher) findViolatingMetrics(
+	ctx context.Context,
+	alarm *types.MetricAlarm,
+	window events.TimeWindow,
+) (*findings, error) {
+	if query := insightsQuery(alarm); query != nil {
+		return e.findInsightsViolations(ctx, alarm, query, window)
+	}
+
+	var (
+		candidates []candidate
+		err        error
+	)
+
+	d := e.newDiscovery(alarm, window)
+
+	if len(alarm.Metrics) > 0 {
+		candidates, err = e.findMetricMathCandidates(ctx, alarm, d)
+	} else {
+		candidates, err = e.findMetricCandidates(ctx, alarm, d)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	found := &findings{}
+	if len(candidates) > 0 {
+		found, err = e.analyzeMetricsForViolations(ctx, alarm, candidates, window)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if d.sampledOut > 0 {
+		found.errors = append(found.errors, e.sampledError(d.sampledOut))
+	}
+
+	return found, nil
+}
+
+// sampledError records the n resources the candidate cap left out.
+func (e *MetricAlarmEnricher) sampledError(n int) events.EnrichmentError {
+	return events.EnrichmentError{
+		Reason:  events.EnrichmentCandidatesSampled,
+		Metrics: n,
+		Message: fmt.Sprintf("evaluated a sample of %d candidates", e.maxCandidates),
+	}
+}
+
+// findMetricCandidates drills a single-metric alarm down to the most detailed metrics it covers.
+func (e *MetricAlarmEnricher) findMetricCandidates(
+	ctx context.Context,
+	alarm *types.MetricAlarm,
+	d *discovery,
+) ([]candidate, error) {
 	metricNamespace := aws.ToString(alarm.Namespace)
 	metricName := aws.ToString(alarm.MetricName)
 
-	metrics, err := e.findMetricsWithMostDimensions(ctx, metricNamespace, metricName, dimensionFilters)
+	metrics, err := e.drillDown(ctx, d, metricNamespace, metricName, toDimensionFilters(alarm.Dimensions))
 	if err != nil {
 		return nil, err
 	}
 
-	if len(metrics) == 0 {
-		return []events.ViolatingMetric{}, nil
+	stat := string(alarm.Statistic)
+	if stat == "" {
+		stat = aws.ToString(alarm.ExtendedStatistic)
 	}
 
-	return e.analyzeMetricsForViolations(ctx, alarm, metrics)
+	candidates := make([]candidate, len(metrics))
+	for i, metric := range metrics {
+		candidates[i] = candidate{
+			metric: metric,
+			queries: []types.MetricDataQuery{{
+				Id: aws.String(candidateQueryID(i)),
+				MetricStat: &types.MetricStat{
+					Metric: metric,
+					Period: alarm.Period,
+					Stat:   aws.String(stat),
+				},
+				ReturnData: aws.Bool(true),
+			}},
+		}
+	}
+
+	return candidates, nil
 }
 
-func (e *MetricAlarmEnricher) findMetricsWithMostDimensions(
+// drillDown lists the metrics matching the filters, from the metric cache when it has them, and
+// returns those the drill-down strategy selects and the dimension filter keeps for evaluation,
+// sampled down to the candidate cap.
+func (e *MetricAlarmEnricher) drillDown(
 	ctx context.Context,
+	d *discovery,
 	namespace, metricName string,
 	dimensions []types.DimensionFilter,
 ) ([]*types.Metric, error) {
-	paginator := cloudwatch.NewListMetricsPaginator(e.cw, &cloudwatch.ListMetricsInput{
+	ctx, span := tracer.Start(ctx, "alarm.list_metrics")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("metric.namespace", namespace),
+		attribute.String("metric.name", metricName),
+		attribute.String("drill_down.strategy", e.drillDownStrategy.String()),
+		attribute.Bool("metrics.recently_active", d.recentlyActive),
+	)
+
+	listed, err := e.cachedListMetrics(ctx, namespace, metricName, dimensions, d.recentlyActive)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]*types.Metric, len(listed))
+	for i := range listed {
+		metrics[i] = &listed[i]
+	}
+
+	selected := e.drillDownStrategy.Select(metrics, dimensions)
+	kept := e.dimensionFilter.apply(selected, len(dimensions))
+	sampled, sampledOut := e.sample(kept, dimensions)
+	span.SetAttributes(
+		attribute.Int("metrics.listed", len(metrics)),
+		attribute.Int("metrics.filtered", len(selected)-len(kept)),
+		attribute.Int("metrics.sampled_out", sampledOut),
+		attribute.Int("metrics.count", len(sampled)),
+	)
+
+	if sampledOut > 0 {
+		e.logger.WarnContext(ctx, "candidate cap exceeded; evaluating a sample of the candidates",
+			slog.String("namespace", namespace),
+			slog.String("metricName", metricName),
+			slog.Int("candidates", len(kept)),
+			slog.Int("maxCandidates", e.maxCandidates))
+		d.sampledOut = max(d.sampledOut, sampledOut)
+	}
+
+	return sampled, nil
+}
+
+// cachedListMetrics returns the metrics matching the filters from the metric cache, listing and
+// caching them on a miss. The returned slice is the caller's own.
+func (e *MetricAlarmEnricher) cachedListMetrics(
+	ctx context.Context,
+	namespace, metricName string,
+	dimensions []types.DimensionFilter,
+	recentlyActive bool,
+) ([]types.Metric, error) {
+	if e.metricCache == nil {
+		return e.listMetrics(ctx, namespace, metricName, dimensions, recentlyActive)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	key := metricCacheKey(e.accountID, e.region, namespace, metricName, dimensions, recentlyActive)
+
+	cached, ok, err := e.metricCache.Get(ctx, key)
+	if err != nil {
+		e.logger.WarnContext(ctx, "cannot get metrics from cache",
+			slog.String("namespace", namespace),
+			slog.String("metricName", metricName),
+			slog.String("error", err.Error()))
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", ok))
+
+	if ok {
+		return slices.Clone(cached), nil
+	}
+
+	metrics, err := e.listMetrics(ctx, namespace, metricName, dimensions, recentlyActive)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.metricCache.Put(ctx, key, slices.Clone(metrics)); err != nil {
+		e.logger.WarnContext(ctx, "cannot put metrics to cache",
+			slog.String("namespace", namespace),
+			slog.String("metricName", metricName),
+			slog.String("error", err.Error()))
+	}
+
+	return metrics, nil
+}
+
+// listMetrics lists all the metrics matching the filters, or only those that received data in the
+// past three hours when recentlyActive is set.
+func (e *MetricAlarmEnricher) listMetrics(
+	ctx context.Context,
+	namespace, metricName string,
+	dimensions []types.DimensionFilter,
+	recentlyActive bool,
+) ([]types.Metric, error) {
+	input := &cloudwatch.ListMetricsInput{
 		Namespace:  aws.String(namespace),
 		MetricName: aws.String(metricName),
 		Dimensions: dimensions,
-	})
+	}
+	if recentlyActive {
+		input.RecentlyActive = types.RecentlyActivePt3h
+	}
 
-	var candidates []*types.Metric
-	maxDimensions := len(dimensions)
+	paginator := cloudwatch.NewListMetricsPaginator(e.cw, input)
+
+	var metrics []types.Metric
 
 	for paginator.HasMorePages() {
 		page, err := paginator.NextPage(ctx)
@@ -165,86 +748,164 @@ func (e *MetricAlarmEnricher) findMetricsWithMostDimensions(
 			return nil, fmt.Errorf("cannot list metrics on next page: %w", err)
 		}
 
-		for _, m := range page.Metrics {
-			dimCount := len(m.Dimensions)
-
-			if dimCount < maxDimensions {
-				continue
-			}
-
-			// When we find metrics with more dimensions than previously seen,
-			// reset the collection since those metrics provide richer detail.
-			if dimCount > maxDimensions {
-				candidates = []*types.Metric{&m}
-				maxDimensions = dimCount
-			} else {
-				candidates = append(candidates, &m)
-			}
-		}
+		metrics = append(metrics, page.Metrics...)
 	}
 
-	return candidates, nil
+	return metrics, nil
 }
 
+// analyzeMetricsForViolations evaluates the candidates in GetMetricData batches, fetching up to
+// concurrency batches at once. The findings of the batches are merged in batch order so that the
+// result doesn't depend on which batch finishes first. A batch failed by a retryable error, such as
+// throttling, is recorded in the findings and the others are kept; only when every batch fails is
+// the analysis an error. Denied access, invalid credentials and a done context fail the analysis
+// at once and cancel the batches still running.
 func (e *MetricAlarmEnricher) analyzeMetricsForViolations(
 	ctx context.Context,
 	alarm *types.MetricAlarm,
-	metrics []*types.Metric,
-) ([]events.ViolatingMetric, error) {
-	period := time.Duration(*alarm.Period) * time.Second
-	endTime := alignToPeriodBoundary(time.Now(), period)
-	evaluationWindow := period * time.Duration(*alarm.EvaluationPeriods)
-	startTime := endTime.Add(-evaluationWindow)
+	candidates []candidate,
+	window events.TimeWindow,
+) (*findings, error) {
+	batches := batchQueries(candidates, maxQueriesPerRequest)
 
-	stat := string(alarm.Statistic)
-	if stat == "" {
-		stat = aws.ToString(alarm.ExtendedStatistic)
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Int("metric_data.batches", len(batches)),
+		attribute.Int("metric_data.concurrency", e.concurrency),
+	)
+
+	results := make([]findings, len(batches))
+	errs := make([]error, len(batches))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(e.concurrency)
+
+	for i, batch := range batches {
+		g.Go(func() error {
+			err := e.processBatch(gctx, i, batch, candidates, alarm, window, &results[i])
+			if err == nil {
+				return nil
+			}
+			// Errors that would fail every other batch as well cancel them; the others, such as
+			// throttling, only leave this batch out.
+			if isFatal(err) || gctx.Err() != nil {
+				return err
+			}
+			errs[i] = err
+			results[i] = failedBatch(i, batch, err)
+			return nil
+		})
 	}
 
-	metricQueries := make([]types.MetricDataQuery, len(metrics))
-	for i, metric := range metrics {
-		metricQueries[i] = types.MetricDataQuery{
-			Id: aws.String(fmt.Sprintf("m%d", i)),
-			MetricStat: &types.MetricStat{
-				Metric: metric,
-				Period: alarm.Period,
-				Stat:   aws.String(stat),
-			},
-			ReturnData: aws.Bool(true),
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	failed := 0
+	for i, err := range errs {
+		if err == nil {
+			continue
 		}
+		failed++
+		e.logger.WarnContext(ctx, "cannot get metric data of batch",
+			slog.String("alarmName", aws.ToString(alarm.AlarmName)),
+			slog.Int("batch", i),
+			slog.String("error", err.Error()))
 	}
+	span.SetAttributes(attribute.Int("metric_data.failed_batches", failed))
 
-	var violating []events.ViolatingMetric
-	const batchSize = 500
+	if failed > 0 && failed == len(batches) {
+		return nil, errors.Join(errs...)
+	}
 
-	for i := 0; i < len(metricQueries); i += batchSize {
-		end := i + batchSize
-		if end > len(metricQueries) {
-			end = len(metricQueries)
-		}
+	found := &findings{candidates: len(candidates)}
+	for _, r := range results {
+		found.violating = append(found.violating, r.violating...)
+		found.silent = append(found.silent, r.silent...)
+		found.healthy = append(found.healthy, r.healthy...)
+		found.incomplete += r.incomplete
+		found.failed += r.failed
+		found.errors = append(found.errors, r.errors...)
+	}
 
-		batchViolating, err := e.processBatch(ctx, metricQueries[i:end], metrics[i:end], alarm, startTime, endTime)
-		if err != nil {
-			return nil, err
+	return found, nil
+}
+
+// fatalErrorCodes are the error codes of requests denied for lack of permissions or valid
+// credentials, which no other request of an enrichment can succeed without.
+var fatalErrorCodes = []string{
+	"AccessDenied",
+	"AccessDeniedException",
+	"UnauthorizedOperation",
+	"ExpiredToken",
+	"ExpiredTokenException",
+	"InvalidClientTokenId",
+	"UnrecognizedClientException",
+	"InvalidSignatureException",
+	"SignatureDoesNotMatch",
+}
+
+// isFatal reports whether a GetMetricData error fails the enrichment as a whole rather than the
+// batch it occurred in.
+func isFatal(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && slices.Contains(fatalErrorCodes, apiErr.ErrorCode())
+}
+
+// failedBatch returns the findings of a batch whose metric data couldn't be fetched: none of its
+// candidates are evaluated.
+func failedBatch(batch int, queries []types.MetricDataQuery, err error) findings {
+	n := 0
+	for _, q := range queries {
+		id := aws.ToString(q.Id)
+		if idx, isBand, err := parseCandidateQueryID(id); err == nil && !isBand && id == candidateQueryID(idx) {
+			n++
 		}
+	}
 
-		violating = append(violating, batchViolating...)
+	return findings{
+		failed: n,
+		errors: []events.EnrichmentError{{
+			Reason:  events.EnrichmentBatchFailed,
+			Batch:   batch,
+			Metrics: n,
+			Message: err.Error(),
+		}},
 	}
+}
 
-	return violating, nil
+// waitForRate blocks until the rate limiter allows another GetMetricData request.
+func (e *MetricAlarmEnricher) waitForRate(ctx context.Context) error {
+	if e.limiter == nil {
+		return nil
+	}
+
+	if err := e.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("cannot wait for GetMetricData rate limit: %w", err)
+	}
+
+	return nil
 }
 
+// processBatch fetches the metric data of a batch of candidates and evaluates them. Candidates
+// whose data is incomplete are recorded as such rather than evaluated.
 func (e *MetricAlarmEnricher) processBatch(
 	ctx context.Context,
+	batch int,
 	queries []types.MetricDataQuery,
-	metrics []*types.Metric,
+	candidates []candidate,
 	alarm *types.MetricAlarm,
-	startTime, endTime time.Time,
-) ([]events.ViolatingMetric, error) {
+	window events.TimeWindow,
+	found *findings,
+) error {
 	paginator := cloudwatch.NewGetMetricDataPaginator(e.cw, &cloudwatch.GetMetricDataInput{
 		MetricDataQueries: queries,
-		StartTime:         aws.Time(startTime),
-		EndTime:           aws.Time(endTime),
+		StartTime:         aws.Time(e.queryStart(alarm, window)),
+		EndTime:           aws.Time(window.End),
 	})
 
 	// Accumulate results across pages - same metric ID may appear multiple times
@@ -252,24 +913,45 @@ func (e *MetricAlarmEnricher) processBatch(
 		values     []float64
 		timestamps []time.Time
 		complete   bool
+		// Anomaly detection bands keyed by Unix timestamp; the band is returned as two series
+		// (lower and upper bound) sharing the same query ID.
+		bands map[int64]*events.Band
 	}
 
 	results := make(map[int]*metricData)
 
 	for paginator.HasMorePages() {
+		if err := e.waitForRate(ctx); err != nil {
+			return err
+		}
+
 		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("cannot get metrics on next page: %w", err)
+			return fmt.Errorf("cannot get metrics on next page: %w", err)
 		}
 
 		for _, result := range page.MetricDataResults {
-			idx, err := strconv.Atoi(strings.TrimPrefix(aws.ToString(result.Id), "m"))
+			idx, isBand, err := parseCandidateQueryID(aws.ToString(result.Id))
 			if err != nil {
-				return nil, fmt.Errorf("cannot parse metric id %q: %w", aws.ToString(result.Id), err)
+				return err
 			}
 
 			if results[idx] == nil {
-				results[idx] = &metricData{}
+				results[idx] = &metricData{bands: make(map[int64]*events.Band)}
+			}
+
+			if isBand {
+				bands := results[idx].bands
+				for i, ts := range result.Timestamps {
+					v := result.Values[i]
+					if b := bands[ts.Unix()]; b != nil {
+						b.Lower = min(b.Lower, v)
+						b.Upper = max(b.Upper, v)
+					} else {
+						bands[ts.Unix()] = &events.Band{Lower: v, Upper: v}
+					}
+				}
+				continue
 			}
 
 			results[idx].values = append(results[idx].values, result.Values...)
@@ -281,39 +963,77 @@ func (e *MetricAlarmEnricher) processBatch(
 		}
 	}
 
-	var violating []events.ViolatingMetric
-	for idx, data := range results {
+	var incomplete []map[string]string
+
+	// Candidates that returned no series at all are left uncounted; findings.summary counts them
+	// as having no data.
+	for _, idx := range slices.Sorted(maps.Keys(results)) {
+		data := results[idx]
 		if !data.complete {
 			e.logger.WarnContext(ctx, "metric data incomplete after pagination",
 				slog.Int("metricIndex", idx))
+			found.incomplete++
+			incomplete = append(incomplete, dimensionsMap(candidates[idx].metric.Dimensions))
 			continue
 		}
 
-		if len(data.values) == 0 {
-			continue
+		points := make([]datapoint, len(data.values))
+		for i, v := range data.values {
+			points[i] = datapoint{
+				value:     v,
+				timestamp: data.timestamps[i],
+				band:      data.bands[data.timestamps[i].Unix()],
+			}
 		}
 
-		var latestIdx int
-		for i, ts := range data.timestamps {
-			if ts.After(data.timestamps[latestIdx]) {
-				latestIdx = i
+		result := e.evaluate(alarm, points, window)
+		if !result.violating {
+			switch {
+			case result.latest != nil:
+				found.healthy = append(found.healthy, e.createViolatingMetric(*candidates[idx].metric, result))
+			case result.lastSeen != nil:
+				found.silent = append(found.silent, e.createSilentMetric(*candidates[idx].metric, result, points))
 			}
+			continue
 		}
 
-		latestValue := data.values[latestIdx]
-		timestamp := data.timestamps[latestIdx]
-
-		if e.isViolatingThreshold(latestValue, alarm) {
-			metric := metrics[idx]
-			vm := e.createViolatingMetric(*metric, latestValue, timestamp)
-			violating = append(violating, vm)
+		vm := e.createViolatingMetric(*candidates[idx].metric, result)
+		if e.history {
+			vm.History = history(points)
 		}
+		found.violating = append(found.violating, vm)
+	}
+
+	if len(incomplete) > 0 {
+		found.errors = append(found.errors, events.EnrichmentError{
+			Reason:     events.EnrichmentDataIncomplete,
+			Batch:      batch,
+			Metrics:    len(incomplete),
+			Dimensions: incomplete,
+		})
+	}
+
+	return nil
+}
+
+// queryStart returns the start time of metric data queries: the start of the evaluation window,
+// moved back by the history lookback when history is recorded, and by the missing data lookback
+// for alarms in INSUFFICIENT_DATA state or ignoring missing data, whichever is longer.
+func (e *MetricAlarmEnricher) queryStart(alarm *types.MetricAlarm, window events.TimeWindow) time.Time {
+	var lookback time.Duration
+	if e.history {
+		lookback = e.historyLookback
+	}
+	if alarm.StateValue == types.StateValueInsufficientData || aws.ToString(alarm.TreatMissingData) == treatMissingIgnore {
+		lookback = max(lookback, e.missingDataLookback)
 	}
 
-	return violating, nil
+	return window.Start.Add(-lookback)
 }
 
-func (e *MetricAlarmEnricher) isViolatingThreshold(value float64, alarm *types.MetricAlarm) bool {
+// isViolatingThreshold reports whether value breaches the alarm threshold. For anomaly detection alarms
+// the value is compared against band, the expected range at the same timestamp.
+func (e *MetricAlarmEnricher) isViolatingThreshold(value float64, band *events.Band, alarm *types.MetricAlarm) bool {
 	threshold := aws.ToFloat64(alarm.Threshold)
 
 	switch alarm.ComparisonOperator {
@@ -325,23 +1045,46 @@ func (e *MetricAlarmEnricher) isViolatingThreshold(value float64, alarm *types.M
 		return value < threshold
 	case types.ComparisonOperatorLessThanOrEqualToThreshold:
 		return value <= threshold
+	case types.ComparisonOperatorLessThanLowerOrGreaterThanUpperThreshold:
+		return band != nil && (value < band.Lower || value > band.Upper)
+	case types.ComparisonOperatorGreaterThanUpperThreshold:
+		return band != nil && value > band.Upper
+	case types.ComparisonOperatorLessThanLowerThreshold:
+		return band != nil && value < band.Lower
 	default:
-		// For anomaly detection or unknown operators, assume violation
-		return true
+		// Unknown operators must not flag every candidate as violating.
+		return false
 	}
 }
 
-func (e *MetricAlarmEnricher) createViolatingMetric(metric types.Metric, value float64, timestamp time.Time) events.ViolatingMetric {
-	dimensions := make(map[string]string)
-	for _, dim := range metric.Dimensions {
-		dimensions[aws.ToString(dim.Name)] = aws.ToString(dim.Value)
+func (e *MetricAlarmEnricher) createViolatingMetric(metric types.Metric, result evaluation) events.ViolatingMetric {
+	vm := events.ViolatingMetric{
+		Dimensions:          dimensionsMap(metric.Dimensions),
+		BreachingDatapoints: result.breaching,
+		EvaluatedDatapoints: result.evaluated,
 	}
 
-	return events.ViolatingMetric{
-		Value:      value,
-		Dimensions: dimensions,
-		Timestamp:  timestamp,
+	if result.latest != nil {
+		vm.Value = result.latest.value
+		vm.Timestamp = result.latest.timestamp
+		vm.Band = result.latest.band
+	}
+
+	return vm
+}
+
+// createSilentMetric describes a metric without datapoints in the evaluation window by its last
+// datapoint before it.
+func (e *MetricAlarmEnricher) createSilentMetric(metric types.Metric, result evaluation, points []datapoint) events.ViolatingMetric {
+	vm := e.createViolatingMetric(metric, result)
+	vm.Value = result.lastSeen.value
+	vm.Timestamp = result.lastSeen.timestamp
+
+	if e.history {
+		vm.History = history(points)
 	}
+
+	return vm
 }
 
 // alignToPeriodBoundary aligns a timestamp to CloudWatch period boundaries.
@@ -2,18 +2,24 @@ package alarm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/smithy-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
 )
 
 func setupEnricher(t *testing.T) (*CloudWatchAPIMock, *MetricAlarmEnricher) {
@@ -28,6 +34,7 @@ func setupEnricher(t *testing.T) (*CloudWatchAPIMock, *MetricAlarmEnricher) {
 func newDescribeAlarmInput(alarmName string) *cloudwatch.DescribeAlarmsInput {
 	return &cloudwatch.DescribeAlarmsInput{
 		AlarmNames: []string{alarmName},
+		AlarmTypes: []types.AlarmType{types.AlarmTypeMetricAlarm, types.AlarmTypeCompositeAlarm},
 		MaxRecords: aws.Int32(1),
 	}
 }
@@ -82,7 +89,7 @@ func TestEnrich_AlarmNotFound(t *testing.T) {
 		MetricAlarms: []types.MetricAlarm{},
 	}, nil).Once()
 
-	_, err := enricher.Enrich(context.Background(), alarmName)
+	_, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "not found")
 	mockCW.AssertExpectations(t)
@@ -99,7 +106,7 @@ func TestEnrich_DescribeAlarmsError(t *testing.T) {
 		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
 	).Return((*cloudwatch.DescribeAlarmsOutput)(nil), expectedError).Once()
 
-	_, err := enricher.Enrich(context.Background(), alarmName)
+	_, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), expectedError.Error())
 	mockCW.AssertExpectations(t)
@@ -119,7 +126,7 @@ func TestEnrich_AlarmNotInAlarmState(t *testing.T) {
 		},
 	}, nil).Once()
 
-	event, err := enricher.Enrich(context.Background(), alarmName)
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
 	require.NoError(t, err)
 	assert.NotNil(t, event)
 	assert.Empty(t, event.ViolatingMetrics)
@@ -158,7 +165,7 @@ func TestEnrich_ListMetricsError(t *testing.T) {
 		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
 	).Return((*cloudwatch.ListMetricsOutput)(nil), expectedError).Once()
 
-	_, err := enricher.Enrich(context.Background(), alarmName)
+	_, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), expectedError.Error())
 	mockCW.AssertExpectations(t)
@@ -203,7 +210,7 @@ func TestEnrich_NoEnrichedMetricsFound(t *testing.T) {
 		Metrics: []types.Metric{},
 	}, nil).Once()
 
-	event, err := enricher.Enrich(context.Background(), alarmName)
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
 	require.NoError(t, err)
 	assert.NotNil(t, event)
 	assert.Empty(t, event.ViolatingMetrics)
@@ -242,7 +249,7 @@ func TestEnrich_GetMetricDataError(t *testing.T) {
 		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
 	).Return((*cloudwatch.GetMetricDataOutput)(nil), expectedError).Once()
 
-	_, err := enricher.Enrich(context.Background(), alarmName)
+	_, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), expectedError.Error())
 	mockCW.AssertExpectations(t)
@@ -289,7 +296,7 @@ func TestEnrich_SuccessfulEnrichmentWithViolations(t *testing.T) {
 		},
 	}, nil).Once()
 
-	event, err := enricher.Enrich(context.Background(), alarmName)
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
 	require.NoError(t, err)
 	assert.NotNil(t, event)
 	assert.NotEmpty(t, event.ViolatingMetrics)
@@ -340,23 +347,24 @@ func TestEnrich_SuccessfulEnrichmentWithoutViolations(t *testing.T) {
 		},
 	}, nil).Once()
 
-	event, err := enricher.Enrich(context.Background(), alarmName)
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
 	require.NoError(t, err)
 	assert.NotNil(t, event)
 	assert.Empty(t, event.ViolatingMetrics)
 	mockCW.AssertExpectations(t)
 }
 
-func TestEnrich_AlarmWithNoDimensions(t *testing.T) {
+func TestEnrich_EvaluationWindowAnchoredAtStateChange(t *testing.T) {
 	mockCW, enricher := setupEnricher(t)
-	alarmName := "test-alarm-no-dimensions"
-	metricName := "AccountLimit"
-	namespace := "AWS/Usage"
+	alarmName := "test-alarm-delayed-delivery"
+	instanceID := "i-0abcdef1234567890"
+	stateChangedAt := time.Date(2025, 10, 2, 6, 3, 27, 0, time.UTC)
 
-	alarm := newMetricAlarm(alarmName, metricName, namespace, types.StateValueAlarm)
-	alarm.Threshold = aws.Float64(80.0)
-	alarm.Period = aws.Int32(300)
-	alarm.Dimensions = []types.Dimension{}
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+	alarm.EvaluationPeriods = aws.Int32(3)
+
+	wantStart := time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC)
+	wantEnd := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
 
 	mockCW.On("DescribeAlarms",
 		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
@@ -372,41 +380,175 @@ func TestEnrich_AlarmWithNoDimensions(t *testing.T) {
 		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
 	).Return(&cloudwatch.ListMetricsOutput{
 		Metrics: []types.Metric{
-			newMetric(metricName, namespace, []types.Dimension{}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", instanceID)}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.GetMetricDataInput) bool {
+			return aws.ToTime(input.StartTime).Equal(wantStart) && aws.ToTime(input.EndTime).Equal(wantEnd)
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{70.0, 80.0, 90.0}, []time.Time{
+				wantStart,
+				wantStart.Add(time.Minute),
+				wantStart.Add(2 * time.Minute),
+			}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{
+		AlarmName:      alarmName,
+		StateChangedAt: stateChangedAt,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, event.EvaluationWindow)
+	assert.Equal(t, wantStart, event.EvaluationWindow.Start)
+	assert.Equal(t, wantEnd, event.EvaluationWindow.End)
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, 90.0, event.ViolatingMetrics[0].Value)
+	assert.Equal(t, 3, event.ViolatingMetrics[0].BreachingDatapoints)
+	mockCW.AssertExpectations(t)
+}
+
+const stateChangePayload = `{
+	"alarmName": "cpu-high",
+	"state": {
+		"value": "ALARM",
+		"reason": "Threshold Crossed: 2 out of the last 3 datapoints [90.0 (02/10/25 06:02:00), 80.0 (02/10/25 06:01:00)] were greater than the threshold (50.0) (minimum 2 datapoints for OK -> ALARM transition).",
+		"reasonData": "{\"version\":\"1.0\",\"statistic\":\"Average\",\"period\":60,\"recentDatapoints\":[80.0,90.0],\"threshold\":50.0}",
+		"timestamp": "2025-10-02T06:03:27.000+0000"
+	},
+	"previousState": {
+		"value": "OK",
+		"reason": "Threshold Crossed: no datapoints were received for 3 periods.",
+		"timestamp": "2025-10-01T22:00:00.000+0000"
+	},
+	"configuration": {
+		"metrics": [{
+			"id": "m1",
+			"metricStat": {
+				"metric": {"namespace": "AWS/EC2", "name": "CPUUtilization", "dimensions": {"AutoScalingGroupName": "web"}},
+				"period": 60,
+				"stat": "Average"
+			},
+			"returnData": true
+		}]
+	}
+}`
+
+func TestEnrich_StateChangeWithConfigurationSkipsDescribeAlarms(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	instanceID := "i-0abcdef1234567890"
+
+	var stateChange events.AlarmStateChange
+	require.NoError(t, json.Unmarshal([]byte(stateChangePayload), &stateChange))
+	stateChangedAt, err := stateChange.State.Time()
+	require.NoError(t, err)
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.ListMetricsInput) bool {
+			return aws.ToString(input.MetricName) == "CPUUtilization" && aws.ToString(input.Namespace) == "AWS/EC2"
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{
+				newDimension("AutoScalingGroupName", "web"),
+				newDimension("InstanceId", instanceID),
+			}),
 		},
 	}, nil).Once()
 
+	start := time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC)
 	mockCW.On("GetMetricData",
 		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
 		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
 		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
 	).Return(&cloudwatch.GetMetricDataOutput{
 		MetricDataResults: []types.MetricDataResult{
-			newMetricDataResult("m0", []float64{85.0}, []time.Time{time.Now().Add(-5 * time.Minute)}),
+			newMetricDataResult("m0", []float64{20.0, 80.0, 90.0}, []time.Time{
+				start,
+				start.Add(time.Minute),
+				start.Add(2 * time.Minute),
+			}),
 		},
 	}, nil).Once()
 
-	event, err := enricher.Enrich(context.Background(), alarmName)
+	alarmARN := "arn:aws:cloudwatch:eu-north-1:111111111111:alarm:cpu-high"
+	event, err := enricher.Enrich(context.Background(), Request{
+		AlarmName:      stateChange.AlarmName,
+		StateChangedAt: stateChangedAt,
+		StateChange:    &stateChange,
+		AlarmARN:       alarmARN,
+	})
 	require.NoError(t, err)
-	assert.NotNil(t, event)
-	assert.NotEmpty(t, event.ViolatingMetrics)
-	assert.Len(t, event.ViolatingMetrics, 1)
-	assert.Equal(t, 85.0, event.ViolatingMetrics[0].Value)
-	assert.Empty(t, event.ViolatingMetrics[0].Dimensions)
+	require.NotNil(t, event.Alarm)
+	assert.Equal(t, alarmARN, aws.ToString(event.Alarm.AlarmArn))
+	assert.Equal(t, types.ComparisonOperatorGreaterThanThreshold, event.Alarm.ComparisonOperator)
+	assert.Equal(t, int32(3), aws.ToInt32(event.Alarm.EvaluationPeriods))
+	assert.Equal(t, int32(2), aws.ToInt32(event.Alarm.DatapointsToAlarm))
+	assert.Equal(t, 50.0, aws.ToFloat64(event.Alarm.Threshold))
+	assert.Equal(t, "missing", aws.ToString(event.Alarm.TreatMissingData))
+	assert.Equal(t, &stateChange, event.StateChange)
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, instanceID, event.ViolatingMetrics[0].Dimensions["InstanceId"])
+	assert.Equal(t, 2, event.ViolatingMetrics[0].BreachingDatapoints)
 	mockCW.AssertExpectations(t)
 }
 
-func TestEnrich_MetricDataWithEmptyValues(t *testing.T) {
+func TestEnrich_StateChangeWithoutThresholdDescribesAlarm(t *testing.T) {
 	mockCW, enricher := setupEnricher(t)
-	alarmName := "test-alarm-empty-values"
-	metricName := "RequestCount"
-	namespace := "AWS/ELB"
-	lbName := "my-load-balancer"
+	alarmName := "latency-anomaly"
 
-	alarm := newMetricAlarm(alarmName, metricName, namespace, types.StateValueAlarm)
-	alarm.Statistic = types.StatisticSum
-	alarm.Threshold = aws.Float64(1000.0)
-	alarm.Dimensions = []types.Dimension{newDimension("LoadBalancerName", lbName)}
+	stateChange := &events.AlarmStateChange{
+		AlarmName: alarmName,
+		State: events.AlarmState{
+			Value:  types.StateValueOk,
+			Reason: "Thresholds Crossed: 1 out of the last 1 datapoints was not outside the band.",
+		},
+		Configuration: events.AlarmConfiguration{
+			Metrics: []events.AlarmMetric{{ID: "ad1", Expression: "ANOMALY_DETECTION_BAND(m1, 2)", ReturnData: true}},
+		},
+	}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{newMetricAlarm(alarmName, "", "", types.StateValueOk)},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName, StateChange: stateChange})
+	require.NoError(t, err)
+	assert.Equal(t, stateChange, event.StateChange)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_StateChangeStateOverridesDescribedState(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "cpu-high"
+	instanceID := "i-0abcdef1234567890"
+
+	// A retried ALARM event, delivered after the alarm went back to OK.
+	stateChange := &events.AlarmStateChange{
+		AlarmName: alarmName,
+		State: events.AlarmState{
+			Value:     types.StateValueAlarm,
+			Reason:    "Threshold Crossed",
+			Timestamp: "2025-10-02T06:03:27.000+0000",
+		},
+	}
+	stateChangedAt, err := stateChange.State.Time()
+	require.NoError(t, err)
+
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueOk)
+	alarm.StateReason = aws.String("Threshold Crossed: recovered")
 
 	mockCW.On("DescribeAlarms",
 		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
@@ -422,7 +564,7 @@ func TestEnrich_MetricDataWithEmptyValues(t *testing.T) {
 		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
 	).Return(&cloudwatch.ListMetricsOutput{
 		Metrics: []types.Metric{
-			newMetric(metricName, namespace, []types.Dimension{newDimension("LoadBalancerName", lbName)}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", instanceID)}),
 		},
 	}, nil).Once()
 
@@ -432,17 +574,1941 @@ func TestEnrich_MetricDataWithEmptyValues(t *testing.T) {
 		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
 	).Return(&cloudwatch.GetMetricDataOutput{
 		MetricDataResults: []types.MetricDataResult{
-			newMetricDataResult("m0", []float64{}, []time.Time{}),
+			newMetricDataResult("m0", []float64{90.0}, []time.Time{time.Date(2025, 10, 2, 6, 2, 0, 0, time.UTC)}),
 		},
 	}, nil).Once()
 
-	event, err := enricher.Enrich(context.Background(), alarmName)
+	event, err := enricher.Enrich(context.Background(), Request{
+		AlarmName:      alarmName,
+		StateChangedAt: stateChangedAt,
+		StateChange:    stateChange,
+	})
 	require.NoError(t, err)
-	assert.NotNil(t, event)
+	assert.Equal(t, types.StateValueAlarm, event.StateValue())
+	assert.Equal(t, "Threshold Crossed", event.StateReason())
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, instanceID, event.ViolatingMetrics[0].Dimensions["InstanceId"])
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_UsesClientOfAlarmAccountAndRegion(t *testing.T) {
+	defaultCW := &CloudWatchAPIMock{}
+	memberCW := &CloudWatchAPIMock{}
+	clients := &ClientProviderMock{}
+	enricher := NewMetricAlarmEnricher(defaultCW, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithClientProvider(clients))
+
+	alarmName := "member-alarm"
+	accountID := "222222222222"
+
+	clients.On("Client", mock.Anything, accountID, "us-east-1").Return(memberCW, nil).Once()
+
+	memberCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{newMetricAlarm(alarmName, "", "", types.StateValueOk)},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{
+		AlarmName: alarmName,
+		AccountID: accountID,
+		Region:    "us-east-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, accountID, event.AccountID)
+	assert.Equal(t, "us-east-1", event.Region)
+	clients.AssertExpectations(t)
+	memberCW.AssertExpectations(t)
+	defaultCW.AssertNotCalled(t, "DescribeAlarms", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestEnrich_ClientProviderError(t *testing.T) {
+	clients := &ClientProviderMock{}
+	enricher := NewMetricAlarmEnricher(&CloudWatchAPIMock{}, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithClientProvider(clients))
+
+	expectedError := errors.New("invalid account ID")
+	clients.On("Client", mock.Anything, "member", "").Return(nil, expectedError).Once()
+
+	_, err := enricher.Enrich(context.Background(), Request{AlarmName: "member-alarm", AccountID: "member"})
+	require.ErrorIs(t, err, expectedError)
+	clients.AssertExpectations(t)
+}
+
+func TestEnrich_History(t *testing.T) {
+	mockCW := &CloudWatchAPIMock{}
+	enricher := NewMetricAlarmEnricher(mockCW, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithHistory(10*time.Minute))
+
+	alarmName := "test-alarm-with-history"
+	stateChangedAt := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
+	windowStart := time.Date(2025, 10, 2, 6, 2, 0, 0, time.UTC)
+
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-12345")}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.GetMetricDataInput) bool {
+			return aws.ToTime(input.StartTime).Equal(windowStart.Add(-10 * time.Minute))
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			// Newest first, as GetMetricData returns them by default.
+			newMetricDataResult("m0", []float64{90.0, 40.0, 20.0}, []time.Time{
+				windowStart,
+				windowStart.Add(-time.Minute),
+				windowStart.Add(-5 * time.Minute),
+			}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName, StateChangedAt: stateChangedAt})
+	require.NoError(t, err)
+	require.Len(t, event.ViolatingMetrics, 1)
+
+	vm := event.ViolatingMetrics[0]
+	assert.Equal(t, 90.0, vm.Value)
+	assert.Equal(t, 1, vm.BreachingDatapoints, "lookback datapoints are not evaluated")
+	assert.Equal(t, []events.Datapoint{
+		{Timestamp: windowStart.Add(-5 * time.Minute), Value: 20.0},
+		{Timestamp: windowStart.Add(-time.Minute), Value: 40.0},
+		{Timestamp: windowStart, Value: 90.0},
+	}, vm.History)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_RanksAndCapsViolatingMetrics(t *testing.T) {
+	mockCW := &CloudWatchAPIMock{}
+	enricher := NewMetricAlarmEnricher(mockCW, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithMaxViolatingMetrics(3))
+
+	alarmName := "test-alarm-ranked"
+	stateChangedAt := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
+	windowStart := time.Date(2025, 10, 2, 6, 2, 0, 0, time.UTC)
+
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-c")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-b")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-a")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-d")}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{60.0}, []time.Time{windowStart}),
+			newMetricDataResult("m1", []float64{95.0}, []time.Time{windowStart}),
+			newMetricDataResult("m2", []float64{60.0}, []time.Time{windowStart}),
+			newMetricDataResult("m3", []float64{75.0}, []time.Time{windowStart}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName, StateChangedAt: stateChangedAt})
+	require.NoError(t, err)
+	require.Len(t, event.ViolatingMetrics, 3)
+
+	// Most severe first; ties are broken by dimensions.
+	var instances []string
+	for _, vm := range event.ViolatingMetrics {
+		instances = append(instances, vm.Dimensions["InstanceId"])
+	}
+	assert.Equal(t, []string{"i-b", "i-d", "i-a"}, instances)
+	assert.Equal(t, 1, event.OmittedViolatingMetrics)
+
+	assert.InDelta(t, 45.0, event.ViolatingMetrics[0].Distance, 1e-9)
+	assert.InDelta(t, 0.9, event.ViolatingMetrics[0].RelativeDistance, 1e-9)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_ImpactSummary(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+
+	alarmName := "test-alarm-summary"
+	stateChangedAt := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
+	windowStart := time.Date(2025, 10, 2, 6, 2, 0, 0, time.UTC)
+
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-violating")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-healthy")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-partial")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-empty")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-missing")}),
+		},
+	}, nil).Once()
+
+	partial := newMetricDataResult("m2", []float64{90.0}, []time.Time{windowStart})
+	partial.StatusCode = types.StatusCodePartialData
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{90.0}, []time.Time{windowStart}),
+			newMetricDataResult("m1", []float64{10.0}, []time.Time{windowStart}),
+			partial,
+			newMetricDataResult("m3", nil, nil),
+			// m4 returns no series at all.
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName, StateChangedAt: stateChangedAt})
+	require.NoError(t, err)
+	require.Len(t, event.ViolatingMetrics, 1)
+
+	assert.Equal(t, &events.ImpactSummary{
+		Candidates:     5,
+		Violating:      1,
+		Healthy:        1,
+		NoData:         2,
+		Incomplete:     1,
+		ViolatingRatio: 0.2,
+	}, event.Summary)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_InsufficientDataFindsSilentMetrics(t *testing.T) {
+	mockCW := &CloudWatchAPIMock{}
+	enricher := NewMetricAlarmEnricher(mockCW, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithMissingDataLookback(30*time.Minute))
+
+	alarmName := "test-alarm-insufficient-data"
+	stateChangedAt := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
+	windowStart := time.Date(2025, 10, 2, 6, 2, 0, 0, time.UTC)
+
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueInsufficientData)
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-reporting")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-silent-recently")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-silent-long")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-gone")}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.GetMetricDataInput) bool {
+			return aws.ToTime(input.StartTime).Equal(windowStart.Add(-30 * time.Minute))
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{10.0, 12.0}, []time.Time{windowStart, windowStart.Add(-time.Minute)}),
+			newMetricDataResult("m1", []float64{30.0, 20.0}, []time.Time{
+				windowStart.Add(-2 * time.Minute),
+				windowStart.Add(-3 * time.Minute),
+			}),
+			newMetricDataResult("m2", []float64{40.0}, []time.Time{windowStart.Add(-20 * time.Minute)}),
+			newMetricDataResult("m3", nil, nil),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName, StateChangedAt: stateChangedAt})
+	require.NoError(t, err)
+
 	assert.Empty(t, event.ViolatingMetrics)
+	require.Len(t, event.SilentMetrics, 2)
+
+	// The longest silent come first, described by their last datapoint.
+	assert.Equal(t, "i-silent-long", event.SilentMetrics[0].Dimensions["InstanceId"])
+	assert.Equal(t, windowStart.Add(-20*time.Minute), event.SilentMetrics[0].Timestamp)
+	assert.Equal(t, "i-silent-recently", event.SilentMetrics[1].Dimensions["InstanceId"])
+	assert.Equal(t, windowStart.Add(-2*time.Minute), event.SilentMetrics[1].Timestamp)
+	assert.Equal(t, 30.0, event.SilentMetrics[1].Value)
+
+	require.NotNil(t, event.Summary)
+	assert.Equal(t, 1, event.Summary.Healthy)
+	assert.Equal(t, 3, event.Summary.NoData)
 	mockCW.AssertExpectations(t)
 }
 
+func TestEnrich_IgnoreMissingDataKeepsState(t *testing.T) {
+	mockCW := &CloudWatchAPIMock{}
+	enricher := NewMetricAlarmEnricher(mockCW, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithMissingDataLookback(30*time.Minute))
+
+	alarmName := "test-alarm-ignore-missing"
+	stateChangedAt := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
+	windowStart := time.Date(2025, 10, 2, 6, 2, 0, 0, time.UTC)
+
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+	alarm.TreatMissingData = aws.String("ignore")
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-reporting")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-kept")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-recovered")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-gone")}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.GetMetricDataInput) bool {
+			return aws.ToTime(input.StartTime).Equal(windowStart.Add(-30 * time.Minute))
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{95.0}, []time.Time{windowStart}),
+			newMetricDataResult("m1", []float64{90.0}, []time.Time{windowStart.Add(-5 * time.Minute)}),
+			newMetricDataResult("m2", []float64{10.0}, []time.Time{windowStart.Add(-5 * time.Minute)}),
+			newMetricDataResult("m3", nil, nil),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName, StateChangedAt: stateChangedAt})
+	require.NoError(t, err)
+
+	require.Len(t, event.ViolatingMetrics, 2)
+	assert.Equal(t, "i-reporting", event.ViolatingMetrics[0].Dimensions["InstanceId"])
+	assert.Equal(t, 1, event.ViolatingMetrics[0].EvaluatedDatapoints)
+
+	// Without data in the window, the resource keeps the state of its last datapoint.
+	assert.Equal(t, "i-kept", event.ViolatingMetrics[1].Dimensions["InstanceId"])
+	assert.Equal(t, 90.0, event.ViolatingMetrics[1].Value)
+	assert.Equal(t, windowStart.Add(-5*time.Minute), event.ViolatingMetrics[1].Timestamp)
+	assert.Zero(t, event.ViolatingMetrics[1].EvaluatedDatapoints)
+
+	require.NotNil(t, event.Summary)
+	assert.Equal(t, 1, event.Summary.Healthy)
+	assert.Equal(t, 1, event.Summary.NoData)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_RecoveryReportsResolvedMetrics(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+
+	alarmName := "test-alarm-recovered"
+	alarmedAt := time.Date(2025, 10, 2, 5, 0, 30, 0, time.UTC)
+	recoveredAt := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
+	alarmWindowStart := time.Date(2025, 10, 2, 4, 59, 0, 0, time.UTC)
+	windowStart := time.Date(2025, 10, 2, 6, 2, 0, 0, time.UTC)
+
+	stateChange := &events.AlarmStateChange{
+		AlarmName:     alarmName,
+		State:         events.AlarmState{Value: types.StateValueOk, Timestamp: "2025-10-02T06:03:00.000+0000"},
+		PreviousState: events.AlarmState{Value: types.StateValueAlarm, Timestamp: "2025-10-02T05:00:30.000+0000"},
+	}
+
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueOk)
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-resolved")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-still")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-healthy")}),
+		},
+	}, nil).Twice()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.GetMetricDataInput) bool {
+			return aws.ToTime(input.StartTime).Equal(alarmWindowStart)
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{90.0}, []time.Time{alarmWindowStart}),
+			newMetricDataResult("m1", []float64{70.0}, []time.Time{alarmWindowStart}),
+			newMetricDataResult("m2", []float64{10.0}, []time.Time{alarmWindowStart}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.GetMetricDataInput) bool {
+			return aws.ToTime(input.StartTime).Equal(windowStart)
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{20.0}, []time.Time{windowStart}),
+			newMetricDataResult("m1", []float64{60.0}, []time.Time{windowStart}),
+			newMetricDataResult("m2", []float64{10.0}, []time.Time{windowStart}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{
+		AlarmName:      alarmName,
+		StateChangedAt: recoveredAt,
+		StateChange:    stateChange,
+	})
+	require.NoError(t, err)
+	require.True(t, event.IsRecovery())
+
+	r := event.Recovery
+	assert.True(t, alarmedAt.Equal(r.AlarmedAt), "alarmed at %s", r.AlarmedAt)
+	assert.Equal(t, recoveredAt, r.RecoveredAt)
+	assert.Equal(t, time.Hour+2*time.Minute+30*time.Second, r.Duration())
+	require.NotNil(t, r.AlarmWindow)
+	assert.True(t, alarmWindowStart.Equal(r.AlarmWindow.Start), "alarm window starts at %s", r.AlarmWindow.Start)
+
+	require.Len(t, r.ResolvedMetrics, 1)
+	assert.Equal(t, "i-resolved", r.ResolvedMetrics[0].Dimensions["InstanceId"])
+	assert.Equal(t, 20.0, r.ResolvedMetrics[0].Value)
+	assert.Equal(t, 1, r.StillViolating)
+	assert.Empty(t, event.ViolatingMetrics)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_OKWithoutPreviousAlarmIsNotRecovery(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+
+	alarmName := "test-alarm-ok"
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueOk)
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{
+		AlarmName: alarmName,
+		StateChange: &events.AlarmStateChange{
+			AlarmName:     alarmName,
+			State:         events.AlarmState{Value: types.StateValueOk, Timestamp: "2025-10-02T06:03:00.000+0000"},
+			PreviousState: events.AlarmState{Value: types.StateValueInsufficientData, Timestamp: "2025-10-02T05:00:30.000+0000"},
+		},
+	})
+	require.NoError(t, err)
+	assert.False(t, event.IsRecovery())
+	assert.Empty(t, event.ViolatingMetrics)
+	mockCW.AssertExpectations(t)
+}
+
+// batchCloudWatch answers GetMetricData itself, with one datapoint per query valued by the index
+// of its candidate, and records how many requests were in flight at once.
+type batchCloudWatch struct {
+	*CloudWatchAPIMock
+
+	at      time.Time
+	failID  string
+	failErr error
+
+	inFlight atomic.Int32
+	peak     atomic.Int32
+	served   atomic.Int32
+}
+
+func (c *batchCloudWatch) GetMetricData(
+	ctx context.Context,
+	input *cloudwatch.GetMetricDataInput,
+	_ ...func(*cloudwatch.Options),
+) (*cloudwatch.GetMetricDataOutput, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	select {
+	case <-time.After(20 * time.Millisecond):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	output := &cloudwatch.GetMetricDataOutput{}
+	for _, q := range input.MetricDataQueries {
+		id := aws.ToString(q.Id)
+		if id == c.failID {
+			if c.failErr != nil {
+				return nil, c.failErr
+			}
+			return nil, errors.New("throttled")
+		}
+
+		idx, _, err := parseCandidateQueryID(id)
+		if err != nil {
+			return nil, err
+		}
+		output.MetricDataResults = append(output.MetricDataResults,
+			newMetricDataResult(id, []float64{float64(idx % 100)}, []time.Time{c.at}))
+	}
+
+	c.served.Add(1)
+
+	return output, nil
+}
+
+func newBatchCloudWatch(t *testing.T, alarmName string, candidates int, at time.Time) *batchCloudWatch {
+	t.Helper()
+
+	mockCW := &CloudWatchAPIMock{}
+
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	metrics := make([]types.Metric, candidates)
+	for i := range metrics {
+		metrics[i] = newMetric("CPUUtilization", "AWS/EC2",
+			[]types.Dimension{newDimension("InstanceId", fmt.Sprintf("i-%04d", i))})
+	}
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{Metrics: metrics}, nil).Once()
+
+	return &batchCloudWatch{CloudWatchAPIMock: mockCW, at: at}
+}
+
+func TestEnrich_FetchesBatchesConcurrently(t *testing.T) {
+	stateChangedAt := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
+	cw := newBatchCloudWatch(t, "test-alarm-many-resources", 2000, stateChangedAt.Add(-time.Minute))
+
+	enricher := NewMetricAlarmEnricher(cw, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithConcurrency(3), WithRateLimit(1000, 3))
+
+	event, err := enricher.Enrich(context.Background(), Request{
+		AlarmName:      "test-alarm-many-resources",
+		StateChangedAt: stateChangedAt,
+	})
+	require.NoError(t, err)
+
+	// Values 51-99 of every 100 candidates violate the threshold of 50.
+	assert.Len(t, event.ViolatingMetrics, 20*49)
+	assert.Equal(t, 2000, event.Summary.Candidates)
+	assert.Equal(t, 99.0, event.ViolatingMetrics[0].Value)
+	assert.Equal(t, "i-0099", event.ViolatingMetrics[0].Dimensions["InstanceId"])
+
+	assert.LessOrEqual(t, cw.peak.Load(), int32(3))
+	assert.Greater(t, cw.peak.Load(), int32(1))
+	cw.AssertExpectations(t)
+}
+
+func TestEnrich_FailedBatchYieldsPartialEvent(t *testing.T) {
+	stateChangedAt := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
+	cw := newBatchCloudWatch(t, "test-alarm-failing-batch", 2000, stateChangedAt.Add(-time.Minute))
+	cw.failID = candidateQueryID(600)
+
+	enricher := NewMetricAlarmEnricher(cw, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithConcurrency(2))
+
+	event, err := enricher.Enrich(context.Background(), Request{
+		AlarmName:      "test-alarm-failing-batch",
+		StateChangedAt: stateChangedAt,
+	})
+	require.NoError(t, err)
+
+	assert.True(t, event.Partial)
+	require.Len(t, event.EnrichmentErrors, 1)
+	assert.Equal(t, events.EnrichmentBatchFailed, event.EnrichmentErrors[0].Reason)
+	assert.Equal(t, 1, event.EnrichmentErrors[0].Batch)
+	assert.Equal(t, 500, event.EnrichmentErrors[0].Metrics)
+	assert.Contains(t, event.EnrichmentErrors[0].Message, "throttled")
+
+	// The other three batches of 500 candidates are still evaluated.
+	assert.Len(t, event.ViolatingMetrics, 15*49)
+	assert.Equal(t, 500, event.Summary.Failed)
+	assert.Zero(t, event.Summary.NoData)
+	cw.AssertExpectations(t)
+}
+
+func TestEnrich_FatalBatchErrorCancelsOtherBatches(t *testing.T) {
+	stateChangedAt := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
+	cw := newBatchCloudWatch(t, "test-alarm-denied", 2000, stateChangedAt.Add(-time.Minute))
+	cw.failID = candidateQueryID(0)
+	cw.failErr = &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized"}
+
+	enricher := NewMetricAlarmEnricher(cw, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	_, err := enricher.Enrich(context.Background(), Request{
+		AlarmName:      "test-alarm-denied",
+		StateChangedAt: stateChangedAt,
+	})
+	var apiErr smithy.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "AccessDeniedException", apiErr.ErrorCode())
+	assert.Zero(t, cw.served.Load(), "batches after the denied one are cancelled")
+}
+
+func TestEnrich_EveryBatchFailed(t *testing.T) {
+	stateChangedAt := time.Date(2025, 10, 2, 6, 3, 0, 0, time.UTC)
+	cw := newBatchCloudWatch(t, "test-alarm-failing-batch", 400, stateChangedAt.Add(-time.Minute))
+	cw.failID = candidateQueryID(100)
+
+	enricher := NewMetricAlarmEnricher(cw, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	_, err := enricher.Enrich(context.Background(), Request{
+		AlarmName:      "test-alarm-failing-batch",
+		StateChangedAt: stateChangedAt,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "throttled")
+	cw.AssertExpectations(t)
+}
+
+func TestEnrich_IncompleteMetricDataIsRecorded(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "test-alarm-incomplete"
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-a")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-b")}),
+		},
+	}, nil).Once()
+
+	incomplete := newMetricDataResult("m1", []float64{70.0}, []time.Time{time.Now().Add(-time.Minute)})
+	incomplete.StatusCode = types.StatusCodePartialData
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{60.0}, []time.Time{time.Now().Add(-time.Minute)}),
+			incomplete,
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, "i-a", event.ViolatingMetrics[0].Dimensions["InstanceId"])
+	assert.True(t, event.Partial)
+	assert.Equal(t, []events.EnrichmentError{{
+		Reason:     events.EnrichmentDataIncomplete,
+		Metrics:    1,
+		Dimensions: []map[string]string{{"InstanceId": "i-b"}},
+	}}, event.EnrichmentErrors)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_CachesListMetrics(t *testing.T) {
+	mockCW := new(CloudWatchAPIMock)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	enricher := NewMetricAlarmEnricher(mockCW, logger, WithMetricCache(NewTTLCache(time.Minute, nil)))
+
+	alarmName := "cpu-high"
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+	alarm.Dimensions = []types.Dimension{newDimension("InstanceId", "i-a")}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Twice()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-a")}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{60.0}, []time.Time{time.Now().Add(-time.Minute)}),
+		},
+	}, nil).Twice()
+
+	for range 2 {
+		event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+		require.NoError(t, err)
+		require.Len(t, event.ViolatingMetrics, 1)
+		assert.Equal(t, "i-a", event.ViolatingMetrics[0].Dimensions["InstanceId"])
+	}
+
+	mockCW.AssertExpectations(t)
+}
+
+func TestFallbackEvent(t *testing.T) {
+	req := Request{
+		AlarmName: "cpu-high",
+		AccountID: "111111111111",
+		Region:    "eu-north-1",
+		StateChange: &events.AlarmStateChange{
+			AlarmName: "cpu-high",
+			State: events.AlarmState{
+				Value:  types.StateValueAlarm,
+				Reason: "Threshold Crossed",
+			},
+			Configuration: events.AlarmConfiguration{Description: "CPU above 50%"},
+		},
+	}
+
+	event := FallbackEvent(req, errors.New("throttled"))
+
+	assert.True(t, event.EnrichmentFailed())
+	assert.True(t, event.Partial)
+	assert.Equal(t, "throttled", event.EnrichmentFailure)
+	assert.Equal(t, "cpu-high", event.AlarmName())
+	assert.Equal(t, types.StateValueAlarm, event.StateValue())
+	assert.Equal(t, "Threshold Crossed", event.StateReason())
+	assert.Equal(t, "CPU above 50%", aws.ToString(event.Alarm.AlarmDescription))
+	assert.Equal(t, "111111111111", event.AccountID)
+	assert.NotNil(t, event.ViolatingMetrics)
+}
+
+func TestFallbackEvent_Recovery(t *testing.T) {
+	recoveredAt := time.Date(2025, 10, 2, 7, 0, 0, 0, time.UTC)
+	req := Request{
+		AlarmName:      "cpu-high",
+		StateChangedAt: recoveredAt,
+		StateChange: &events.AlarmStateChange{
+			AlarmName: "cpu-high",
+			State:     events.AlarmState{Value: types.StateValueOk},
+			PreviousState: events.AlarmState{
+				Value:     types.StateValueAlarm,
+				Timestamp: "2025-10-02T06:30:00.000+0000",
+			},
+		},
+	}
+
+	event := FallbackEvent(req, errors.New("throttled"))
+
+	require.True(t, event.IsRecovery())
+	assert.Equal(t, time.Date(2025, 10, 2, 6, 30, 0, 0, time.UTC), event.Recovery.AlarmedAt.UTC())
+	assert.Equal(t, recoveredAt, event.Recovery.RecoveredAt)
+	assert.Equal(t, int64(30*60), event.Recovery.DurationSeconds)
+	assert.Empty(t, event.Recovery.ResolvedMetrics)
+
+	req.StateChange.PreviousState.Value = types.StateValueInsufficientData
+	assert.False(t, FallbackEvent(req, errors.New("throttled")).IsRecovery())
+}
+
+func TestFallbackEvent_RebuildsAlarmFromPayload(t *testing.T) {
+	var stateChange events.AlarmStateChange
+	require.NoError(t, json.Unmarshal([]byte(stateChangePayload), &stateChange))
+
+	alarmARN := "arn:aws:cloudwatch:eu-north-1:111111111111:alarm:cpu-high"
+	event := FallbackEvent(Request{
+		AlarmName:   stateChange.AlarmName,
+		StateChange: &stateChange,
+		AlarmARN:    alarmARN,
+	}, errors.New("throttled"))
+
+	require.NotNil(t, event.Alarm)
+	assert.Equal(t, alarmARN, aws.ToString(event.Alarm.AlarmArn))
+	assert.Equal(t, types.ComparisonOperatorGreaterThanThreshold, event.Alarm.ComparisonOperator)
+	assert.Equal(t, int32(3), aws.ToInt32(event.Alarm.EvaluationPeriods))
+	assert.Equal(t, int32(2), aws.ToInt32(event.Alarm.DatapointsToAlarm))
+	assert.Equal(t, 50.0, aws.ToFloat64(event.Alarm.Threshold))
+}
+
+func TestFallbackEvent_Composite(t *testing.T) {
+	req := Request{
+		AlarmName: "service-down",
+		StateChange: &events.AlarmStateChange{
+			AlarmName:     "service-down",
+			State:         events.AlarmState{Value: types.StateValueAlarm},
+			Configuration: events.AlarmConfiguration{AlarmRule: `ALARM("cpu-high")`},
+		},
+	}
+
+	event := FallbackEvent(req, errors.New("throttled"))
+
+	require.NotNil(t, event.CompositeAlarm)
+	assert.Nil(t, event.Alarm)
+	assert.Equal(t, `ALARM("cpu-high")`, aws.ToString(event.CompositeAlarm.AlarmRule))
+}
+
+func TestEnrich_AlarmOverridesDrillDownStrategy(t *testing.T) {
+	mockCW := new(CloudWatchAPIMock)
+	enricher := NewMetricAlarmEnricher(mockCW, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithAlarmOverrides())
+
+	alarmName := "cluster-cpu-high"
+	alarmARN := "arn:aws:cloudwatch:eu-north-1:111111111111:alarm:cluster-cpu-high"
+	alarm := newMetricAlarm(alarmName, "pod_cpu_utilization", "ContainerInsights", types.StateValueAlarm)
+	alarm.AlarmArn = aws.String(alarmARN)
+	alarm.Dimensions = []types.Dimension{newDimension("ClusterName", "prod")}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListTagsForResource",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		&cloudwatch.ListTagsForResourceInput{ResourceARN: aws.String(alarmARN)},
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListTagsForResourceOutput{
+		Tags: []types.Tag{{Key: aws.String(TagDrillDown), Value: aws.String("keys:Service")}},
+	}, nil).Once()
+
+	listed := make([]types.Metric, 0)
+	for _, m := range containerInsightsMetrics() {
+		listed = append(listed, *m)
+	}
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{Metrics: listed}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.GetMetricDataInput) bool {
+			return len(input.MetricDataQueries) == 2
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{80.0}, []time.Time{time.Now().Add(-time.Minute)}),
+			newMetricDataResult("m1", []float64{20.0}, []time.Time{time.Now().Add(-time.Minute)}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, map[string]string{"ClusterName": "prod", "Service": "api"}, event.ViolatingMetrics[0].Dimensions)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_AlarmOverridesDimensionFilter(t *testing.T) {
+	mockCW := new(CloudWatchAPIMock)
+	enricher := NewMetricAlarmEnricher(mockCW, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithAlarmOverrides(),
+		WithDimensionFilter([]DimensionRule{{Name: "Environment", Value: "prod"}}, nil))
+
+	alarmName := "pod-cpu-high"
+	alarmARN := "arn:aws:cloudwatch:eu-north-1:111111111111:alarm:pod-cpu-high"
+	alarm := newMetricAlarm(alarmName, "pod_cpu_utilization", "ContainerInsights", types.StateValueAlarm)
+	alarm.AlarmArn = aws.String(alarmARN)
+	alarm.Dimensions = []types.Dimension{newDimension("ClusterName", "main")}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListTagsForResource",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		&cloudwatch.ListTagsForResourceInput{ResourceARN: aws.String(alarmARN)},
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListTagsForResourceOutput{
+		Tags: []types.Tag{{Key: aws.String(TagExclude), Value: aws.String("Namespace=kube-system PodName=/^debug-/")}},
+	}, nil).Once()
+
+	var listed []types.Metric
+	for _, m := range podMetrics() {
+		listed = append(listed, *m)
+	}
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{Metrics: listed}, nil).Once()
+
+	// Only api-1 is in prod and neither in kube-system nor a debug pod.
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.GetMetricDataInput) bool {
+			return len(input.MetricDataQueries) == 1
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{80.0}, []time.Time{time.Now().Add(-time.Minute)}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, "api-1", event.ViolatingMetrics[0].Dimensions["PodName"])
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_CapsCandidates(t *testing.T) {
+	mockCW := new(CloudWatchAPIMock)
+	enricher := NewMetricAlarmEnricher(mockCW, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithMaxCandidates(10))
+
+	alarmName := "web-cpu-high"
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+	alarm.Dimensions = []types.Dimension{newDimension("AutoScalingGroupName", "web")}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	var listed []types.Metric
+	for _, m := range instanceMetrics(25) {
+		listed = append(listed, *m)
+	}
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.ListMetricsInput) bool {
+			return input.RecentlyActive == types.RecentlyActivePt3h
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{Metrics: listed}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.GetMetricDataInput) bool {
+			return len(input.MetricDataQueries) == 10
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{80.0}, []time.Time{time.Now().Add(-time.Minute)}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+
+	assert.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, 10, event.Summary.Candidates)
+	assert.True(t, event.Partial)
+	require.Len(t, event.EnrichmentErrors, 1)
+	assert.Equal(t, events.EnrichmentCandidatesSampled, event.EnrichmentErrors[0].Reason)
+	assert.Equal(t, 15, event.EnrichmentErrors[0].Metrics)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_ListsAllMetricsForPastWindows(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "cpu-high"
+	alarm := newMetricAlarm(alarmName, "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.ListMetricsInput) bool {
+			return input.RecentlyActive == ""
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{}, nil).Once()
+
+	_, err := enricher.Enrich(context.Background(), Request{
+		AlarmName:      alarmName,
+		StateChangedAt: time.Now().Add(-6 * time.Hour),
+	})
+	require.NoError(t, err)
+	mockCW.AssertExpectations(t)
+}
+
+func TestThresholdDistance(t *testing.T) {
+	tests := []struct {
+		name            string
+		operator        types.ComparisonOperator
+		threshold       float64
+		value           float64
+		band            *events.Band
+		wantDistance    float64
+		wantRelDistance float64
+	}{
+		{"greater than", types.ComparisonOperatorGreaterThanThreshold, 50, 75, nil, 25, 0.5},
+		{"less than", types.ComparisonOperatorLessThanOrEqualToThreshold, 10, 2, nil, 8, 0.8},
+		{"zero threshold", types.ComparisonOperatorGreaterThanThreshold, 0, 3, nil, 3, 0},
+		{"above band", types.ComparisonOperatorLessThanLowerOrGreaterThanUpperThreshold, 0, 30, &events.Band{Lower: 10, Upper: 20}, 10, 1},
+		{"below band", types.ComparisonOperatorLessThanLowerOrGreaterThanUpperThreshold, 0, 5, &events.Band{Lower: 10, Upper: 20}, 5, 0.5},
+		{"band without band", types.ComparisonOperatorGreaterThanUpperThreshold, 0, 5, nil, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alarm := &types.MetricAlarm{
+				ComparisonOperator: tt.operator,
+				Threshold:          aws.Float64(tt.threshold),
+			}
+
+			distance, relative := thresholdDistance(alarm, tt.value, tt.band)
+			assert.InDelta(t, tt.wantDistance, distance, 1e-9)
+			assert.InDelta(t, tt.wantRelDistance, relative, 1e-9)
+		})
+	}
+}
+
+func TestEnrich_AlarmWithNoDimensions(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "test-alarm-no-dimensions"
+	metricName := "AccountLimit"
+	namespace := "AWS/Usage"
+
+	alarm := newMetricAlarm(alarmName, metricName, namespace, types.StateValueAlarm)
+	alarm.Threshold = aws.Float64(80.0)
+	alarm.Period = aws.Int32(300)
+	alarm.Dimensions = []types.Dimension{}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric(metricName, namespace, []types.Dimension{}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{85.0}, []time.Time{time.Now().Add(-5 * time.Minute)}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	assert.NotNil(t, event)
+	assert.NotEmpty(t, event.ViolatingMetrics)
+	assert.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, 85.0, event.ViolatingMetrics[0].Value)
+	assert.Empty(t, event.ViolatingMetrics[0].Dimensions)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_MetricDataWithEmptyValues(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "test-alarm-empty-values"
+	metricName := "RequestCount"
+	namespace := "AWS/ELB"
+	lbName := "my-load-balancer"
+
+	alarm := newMetricAlarm(alarmName, metricName, namespace, types.StateValueAlarm)
+	alarm.Statistic = types.StatisticSum
+	alarm.Threshold = aws.Float64(1000.0)
+	alarm.Dimensions = []types.Dimension{newDimension("LoadBalancerName", lbName)}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric(metricName, namespace, []types.Dimension{newDimension("LoadBalancerName", lbName)}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{}, []time.Time{}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	assert.NotNil(t, event)
+	assert.Empty(t, event.ViolatingMetrics)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_CompositeAlarmNotInAlarmState(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "ok-composite"
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		CompositeAlarms: []types.CompositeAlarm{{
+			AlarmName:  aws.String(alarmName),
+			AlarmRule:  aws.String(`ALARM("cpu-high")`),
+			StateValue: types.StateValueOk,
+		}},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	assert.Nil(t, event.Alarm)
+	assert.Equal(t, alarmName, event.AlarmName())
+	assert.Equal(t, types.StateValueOk, event.StateValue())
+	assert.Empty(t, event.ChildAlarms)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_CompositeAlarmWithChildren(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "service-degraded"
+	instanceID := "i-0abcdef1234567890"
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		CompositeAlarms: []types.CompositeAlarm{{
+			AlarmName:  aws.String(alarmName),
+			AlarmRule:  aws.String(`ALARM("cpu-high") AND (ALARM(nested) OR OK("latency-high"))`),
+			StateValue: types.StateValueAlarm,
+		}},
+	}, nil).Once()
+
+	cpuAlarm := newMetricAlarm("cpu-high", "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		&cloudwatch.DescribeAlarmsInput{
+			AlarmNames: []string{"cpu-high", "nested", "latency-high"},
+			AlarmTypes: []types.AlarmType{types.AlarmTypeMetricAlarm, types.AlarmTypeCompositeAlarm},
+			StateValue: types.StateValueAlarm,
+		},
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{cpuAlarm},
+		CompositeAlarms: []types.CompositeAlarm{{
+			AlarmName:  aws.String("nested"),
+			AlarmRule:  aws.String(`ALARM("service-degraded")`),
+			StateValue: types.StateValueAlarm,
+		}},
+	}, nil).Once()
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		&cloudwatch.DescribeAlarmsInput{
+			AlarmNames: []string{"service-degraded"},
+			AlarmTypes: []types.AlarmType{types.AlarmTypeMetricAlarm, types.AlarmTypeCompositeAlarm},
+			StateValue: types.StateValueAlarm,
+		},
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		CompositeAlarms: []types.CompositeAlarm{{
+			AlarmName:  aws.String(alarmName),
+			AlarmRule:  aws.String(`ALARM("cpu-high")`),
+			StateValue: types.StateValueAlarm,
+		}},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", instanceID)}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{75.0}, []time.Time{time.Now().Add(-1 * time.Minute)}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	require.NotNil(t, event.CompositeAlarm)
+	assert.Nil(t, event.Alarm)
+	require.Len(t, event.ChildAlarms, 2)
+
+	assert.Equal(t, "cpu-high", aws.ToString(event.ChildAlarms[0].Alarm.AlarmName))
+	require.Len(t, event.ChildAlarms[0].ViolatingMetrics, 1)
+	assert.Equal(t, 75.0, event.ChildAlarms[0].ViolatingMetrics[0].Value)
+	assert.Equal(t, instanceID, event.ChildAlarms[0].ViolatingMetrics[0].Dimensions["InstanceId"])
+
+	// The nested composite refers back to the top-level alarm, which must not be enriched twice.
+	assert.Equal(t, "nested", aws.ToString(event.ChildAlarms[1].CompositeAlarm.AlarmName))
+	assert.Empty(t, event.ChildAlarms[1].ChildAlarms)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_CompositeSharedChildEnrichedOnce(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "service-degraded"
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		CompositeAlarms: []types.CompositeAlarm{{
+			AlarmName:  aws.String(alarmName),
+			AlarmRule:  aws.String(`ALARM("cpu-high") AND ALARM("nested")`),
+			StateValue: types.StateValueAlarm,
+		}},
+	}, nil).Once()
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		&cloudwatch.DescribeAlarmsInput{
+			AlarmNames: []string{"cpu-high", "nested"},
+			AlarmTypes: []types.AlarmType{types.AlarmTypeMetricAlarm, types.AlarmTypeCompositeAlarm},
+			StateValue: types.StateValueAlarm,
+		},
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{
+			newMetricAlarm("cpu-high", "CPUUtilization", "AWS/EC2", types.StateValueAlarm),
+		},
+		CompositeAlarms: []types.CompositeAlarm{{
+			AlarmName:  aws.String("nested"),
+			AlarmRule:  aws.String(`ALARM("cpu-high") OR ALARM("memory-high")`),
+			StateValue: types.StateValueAlarm,
+		}},
+	}, nil).Once()
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		&cloudwatch.DescribeAlarmsInput{
+			AlarmNames: []string{"cpu-high", "memory-high"},
+			AlarmTypes: []types.AlarmType{types.AlarmTypeMetricAlarm, types.AlarmTypeCompositeAlarm},
+			StateValue: types.StateValueAlarm,
+		},
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{
+			newMetricAlarm("cpu-high", "CPUUtilization", "AWS/EC2", types.StateValueAlarm),
+			newMetricAlarm("memory-high", "MemoryUtilization", "AWS/EC2", types.StateValueAlarm),
+		},
+	}, nil).Once()
+
+	// Each metric alarm is enriched once, cpu-high although both composite alarms reference it.
+	for _, metricName := range []string{"CPUUtilization", "MemoryUtilization"} {
+		mockCW.On("ListMetrics",
+			mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+			mock.MatchedBy(func(input *cloudwatch.ListMetricsInput) bool {
+				return aws.ToString(input.MetricName) == metricName
+			}),
+			mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+		).Return(&cloudwatch.ListMetricsOutput{
+			Metrics: []types.Metric{
+				newMetric(metricName, "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-a")}),
+			},
+		}, nil).Once()
+	}
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{75.0}, []time.Time{time.Now().Add(-1 * time.Minute)}),
+		},
+	}, nil).Twice()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	require.Len(t, event.ChildAlarms, 2)
+
+	assert.Equal(t, "cpu-high", aws.ToString(event.ChildAlarms[0].Alarm.AlarmName))
+	require.Len(t, event.ChildAlarms[0].ViolatingMetrics, 1)
+
+	// The nested composite lists only the child not listed before.
+	nested := event.ChildAlarms[1]
+	assert.Equal(t, "nested", aws.ToString(nested.CompositeAlarm.AlarmName))
+	require.Len(t, nested.ChildAlarms, 1)
+	assert.Equal(t, "memory-high", aws.ToString(nested.ChildAlarms[0].Alarm.AlarmName))
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_CompositeChildFailureIsRecorded(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "service-degraded"
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		CompositeAlarms: []types.CompositeAlarm{{
+			AlarmName:  aws.String(alarmName),
+			AlarmRule:  aws.String(`ALARM("cpu-high") AND ALARM("memory-high")`),
+			StateValue: types.StateValueAlarm,
+		}},
+	}, nil).Once()
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		&cloudwatch.DescribeAlarmsInput{
+			AlarmNames: []string{"cpu-high", "memory-high"},
+			AlarmTypes: []types.AlarmType{types.AlarmTypeMetricAlarm, types.AlarmTypeCompositeAlarm},
+			StateValue: types.StateValueAlarm,
+		},
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{
+			newMetricAlarm("cpu-high", "CPUUtilization", "AWS/EC2", types.StateValueAlarm),
+			newMetricAlarm("memory-high", "MemoryUtilization", "AWS/EC2", types.StateValueAlarm),
+		},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.ListMetricsInput) bool {
+			return aws.ToString(input.MetricName) == "CPUUtilization"
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(nil, errors.New("throttled")).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(input *cloudwatch.ListMetricsInput) bool {
+			return aws.ToString(input.MetricName) == "MemoryUtilization"
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("MemoryUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-a")}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{75.0}, []time.Time{time.Now().Add(-1 * time.Minute)}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	assert.True(t, event.Partial)
+	require.Len(t, event.ChildAlarms, 2)
+
+	failed := event.ChildAlarms[0]
+	assert.Equal(t, "cpu-high", aws.ToString(failed.Alarm.AlarmName))
+	assert.True(t, failed.EnrichmentFailed())
+	require.Len(t, failed.EnrichmentErrors, 1)
+	assert.Contains(t, failed.EnrichmentErrors[0].Message, "throttled")
+
+	enriched := event.ChildAlarms[1]
+	assert.False(t, enriched.EnrichmentFailed())
+	require.Len(t, enriched.ViolatingMetrics, 1)
+	assert.Equal(t, "i-a", enriched.ViolatingMetrics[0].Dimensions["InstanceId"])
+	mockCW.AssertExpectations(t)
+}
+
+func newMetricMathAlarm(alarmName string, state types.StateValue) types.MetricAlarm {
+	return types.MetricAlarm{
+		AlarmName:          aws.String(alarmName),
+		StateValue:         state,
+		EvaluationPeriods:  aws.Int32(1),
+		Threshold:          aws.Float64(5.0),
+		ComparisonOperator: types.ComparisonOperatorGreaterThanThreshold,
+		Metrics: []types.MetricDataQuery{
+			{
+				Id: aws.String("errors"),
+				MetricStat: &types.MetricStat{
+					Metric: &types.Metric{Namespace: aws.String("AWS/Lambda"), MetricName: aws.String("Errors")},
+					Period: aws.Int32(60),
+					Stat:   aws.String("Sum"),
+				},
+				ReturnData: aws.Bool(false),
+			},
+			{
+				Id: aws.String("invocations"),
+				MetricStat: &types.MetricStat{
+					Metric: &types.Metric{Namespace: aws.String("AWS/Lambda"), MetricName: aws.String("Invocations")},
+					Period: aws.Int32(60),
+					Stat:   aws.String("Sum"),
+				},
+				ReturnData: aws.Bool(false),
+			},
+			{
+				Id:         aws.String("rate"),
+				Expression: aws.String("errors/invocations*100"),
+				ReturnData: aws.Bool(true),
+			},
+		},
+	}
+}
+
+func matchListMetricsName(metricName string) any {
+	return mock.MatchedBy(func(in *cloudwatch.ListMetricsInput) bool {
+		return aws.ToString(in.MetricName) == metricName
+	})
+}
+
+func TestEnrich_MetricMathAlarm(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "lambda-error-rate"
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{newMetricMathAlarm(alarmName, types.StateValueAlarm)},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		matchListMetricsName("Errors"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("Errors", "AWS/Lambda", []types.Dimension{newDimension("FunctionName", "checkout")}),
+			newMetric("Errors", "AWS/Lambda", []types.Dimension{newDimension("FunctionName", "search")}),
+			newMetric("Errors", "AWS/Lambda", []types.Dimension{newDimension("FunctionName", "orphan")}),
+		},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		matchListMetricsName("Invocations"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("Invocations", "AWS/Lambda", []types.Dimension{newDimension("FunctionName", "search")}),
+			newMetric("Invocations", "AWS/Lambda", []types.Dimension{newDimension("FunctionName", "checkout")}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(in *cloudwatch.GetMetricDataInput) bool {
+			// Two resources matched across both legs, three queries each.
+			if len(in.MetricDataQueries) != 6 {
+				return false
+			}
+			rate := in.MetricDataQueries[2]
+			return aws.ToString(rate.Id) == "m0" &&
+				aws.ToString(rate.Expression) == "m0_errors/m0_invocations*100" &&
+				aws.ToBool(rate.ReturnData) &&
+				!aws.ToBool(in.MetricDataQueries[0].ReturnData)
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{12.5}, []time.Time{time.Now().Add(-1 * time.Minute)}),
+			newMetricDataResult("m1", []float64{0.4}, []time.Time{time.Now().Add(-1 * time.Minute)}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, 12.5, event.ViolatingMetrics[0].Value)
+	assert.Equal(t, "checkout", event.ViolatingMetrics[0].Dimensions["FunctionName"])
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_MetricMathAlarmWithSearchExpression(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "search-alarm"
+
+	alarm := newMetricMathAlarm(alarmName, types.StateValueAlarm)
+	alarm.Metrics = []types.MetricDataQuery{{
+		Id:         aws.String("e1"),
+		Expression: aws.String(`MAX(SEARCH('{AWS/EC2,InstanceId} MetricName="CPUUtilization"', 'Average'))`),
+		Period:     aws.Int32(300),
+		ReturnData: aws.Bool(true),
+	}}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	assert.Empty(t, event.ViolatingMetrics)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_AnomalyDetectionAlarm(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "cpu-anomaly"
+	ts := time.Now().Add(-1 * time.Minute).Truncate(time.Minute)
+
+	alarm := types.MetricAlarm{
+		AlarmName:          aws.String(alarmName),
+		StateValue:         types.StateValueAlarm,
+		EvaluationPeriods:  aws.Int32(1),
+		ComparisonOperator: types.ComparisonOperatorLessThanLowerOrGreaterThanUpperThreshold,
+		ThresholdMetricId:  aws.String("ad1"),
+		Metrics: []types.MetricDataQuery{
+			{
+				Id: aws.String("m1"),
+				MetricStat: &types.MetricStat{
+					Metric: &types.Metric{Namespace: aws.String("AWS/EC2"), MetricName: aws.String("CPUUtilization")},
+					Period: aws.Int32(60),
+					Stat:   aws.String("Average"),
+				},
+				ReturnData: aws.Bool(true),
+			},
+			{
+				Id:         aws.String("ad1"),
+				Expression: aws.String("ANOMALY_DETECTION_BAND(m1, 2)"),
+				ReturnData: aws.Bool(true),
+			},
+		},
+	}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("ListMetrics",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.ListMetricsInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.ListMetricsOutput{
+		Metrics: []types.Metric{
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-1")}),
+			newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("InstanceId", "i-2")}),
+		},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(in *cloudwatch.GetMetricDataInput) bool {
+			band := in.MetricDataQueries[1]
+			return aws.ToString(band.Id) == "b0" &&
+				aws.ToString(band.Expression) == "ANOMALY_DETECTION_BAND(m0, 2)" &&
+				aws.ToBool(band.ReturnData)
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			newMetricDataResult("m0", []float64{93.0}, []time.Time{ts}),
+			newMetricDataResult("b0", []float64{40.0}, []time.Time{ts}),
+			newMetricDataResult("b0", []float64{10.0}, []time.Time{ts}),
+			newMetricDataResult("m1", []float64{25.0}, []time.Time{ts}),
+			newMetricDataResult("b1", []float64{10.0}, []time.Time{ts}),
+			newMetricDataResult("b1", []float64{40.0}, []time.Time{ts}),
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, "i-1", event.ViolatingMetrics[0].Dimensions["InstanceId"])
+	assert.Equal(t, 93.0, event.ViolatingMetrics[0].Value)
+	assert.Equal(t, &events.Band{Lower: 10.0, Upper: 40.0}, event.ViolatingMetrics[0].Band)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_MetricsInsightsAlarm(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "insights-cpu"
+	ts := time.Now().Add(-5 * time.Minute)
+
+	alarm := types.MetricAlarm{
+		AlarmName:          aws.String(alarmName),
+		StateValue:         types.StateValueAlarm,
+		EvaluationPeriods:  aws.Int32(1),
+		Threshold:          aws.Float64(80.0),
+		ComparisonOperator: types.ComparisonOperatorGreaterThanThreshold,
+		Metrics: []types.MetricDataQuery{{
+			Id:         aws.String("q1"),
+			Expression: aws.String(`SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) ORDER BY AVG() DESC LIMIT 10`),
+			Period:     aws.Int32(300),
+			ReturnData: aws.Bool(true),
+		}},
+	}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(in *cloudwatch.GetMetricDataInput) bool {
+			q := in.MetricDataQueries[0]
+			return aws.ToString(q.Expression) == `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY "InstanceId" ORDER BY AVG() DESC LIMIT 10` &&
+				aws.ToString(q.Label) == "${PROP('Dim.InstanceId')}" &&
+				aws.ToInt32(q.Period) == 300
+		}),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			{Id: aws.String("m0"), Label: aws.String("i-1"), Values: []float64{95.0}, Timestamps: []time.Time{ts}, StatusCode: types.StatusCodeComplete},
+			{Id: aws.String("m0"), Label: aws.String("i-2"), Values: []float64{20.0}, Timestamps: []time.Time{ts}, StatusCode: types.StatusCodeComplete},
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, map[string]string{"InstanceId": "i-1"}, event.ViolatingMetrics[0].Dimensions)
+	assert.Equal(t, 95.0, event.ViolatingMetrics[0].Value)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_MetricsInsightsPartialData(t *testing.T) {
+	mockCW, enricher := setupEnricher(t)
+	alarmName := "insights-cpu"
+	ts := time.Now().Add(-5 * time.Minute)
+
+	alarm := types.MetricAlarm{
+		AlarmName:          aws.String(alarmName),
+		StateValue:         types.StateValueAlarm,
+		EvaluationPeriods:  aws.Int32(1),
+		Threshold:          aws.Float64(80.0),
+		ComparisonOperator: types.ComparisonOperatorGreaterThanThreshold,
+		Metrics: []types.MetricDataQuery{{
+			Id:         aws.String("q1"),
+			Expression: aws.String(`SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId`),
+			Period:     aws.Int32(300),
+			ReturnData: aws.Bool(true),
+		}},
+	}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(in *cloudwatch.GetMetricDataInput) bool { return in.NextToken == nil }),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			{Id: aws.String("m0"), Label: aws.String("i-1"), Values: []float64{95.0}, Timestamps: []time.Time{ts}, StatusCode: types.StatusCodeComplete},
+			{Id: aws.String("m0"), Label: aws.String("i-2"), Values: []float64{90.0}, Timestamps: []time.Time{ts}, StatusCode: types.StatusCodePartialData},
+		},
+		NextToken: aws.String("page-2"),
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.MatchedBy(func(in *cloudwatch.GetMetricDataInput) bool { return aws.ToString(in.NextToken) == "page-2" }),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return((*cloudwatch.GetMetricDataOutput)(nil), &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"}).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, map[string]string{"InstanceId": "i-1"}, event.ViolatingMetrics[0].Dimensions)
+	assert.True(t, event.Partial)
+	require.Len(t, event.EnrichmentErrors, 2)
+	assert.Equal(t, events.EnrichmentBatchFailed, event.EnrichmentErrors[0].Reason)
+	assert.Contains(t, event.EnrichmentErrors[0].Message, "Rate exceeded")
+	assert.Equal(t, events.EnrichmentError{
+		Reason:     events.EnrichmentDataIncomplete,
+		Metrics:    1,
+		Dimensions: []map[string]string{{"InstanceId": "i-2"}},
+	}, event.EnrichmentErrors[1])
+	assert.Equal(t, 1, event.Summary.Incomplete)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_MetricsInsightsDimensionFilter(t *testing.T) {
+	mockCW := new(CloudWatchAPIMock)
+	exclude, err := ParseDimensionRules("InstanceId=/^i-debug/")
+	require.NoError(t, err)
+	enricher := NewMetricAlarmEnricher(mockCW, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithDimensionFilter(nil, exclude))
+
+	alarmName := "insights-cpu"
+	ts := time.Now().Add(-5 * time.Minute)
+
+	alarm := types.MetricAlarm{
+		AlarmName:          aws.String(alarmName),
+		StateValue:         types.StateValueAlarm,
+		EvaluationPeriods:  aws.Int32(1),
+		Threshold:          aws.Float64(80.0),
+		ComparisonOperator: types.ComparisonOperatorGreaterThanThreshold,
+		Metrics: []types.MetricDataQuery{{
+			Id:         aws.String("q1"),
+			Expression: aws.String(`SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId`),
+			Period:     aws.Int32(300),
+			ReturnData: aws.Bool(true),
+		}},
+	}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Once()
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []types.MetricDataResult{
+			{Id: aws.String("m0"), Label: aws.String("i-1"), Values: []float64{95.0}, Timestamps: []time.Time{ts}, StatusCode: types.StatusCodeComplete},
+			{Id: aws.String("m0"), Label: aws.String("i-debug-1"), Values: []float64{99.0}, Timestamps: []time.Time{ts}, StatusCode: types.StatusCodeComplete},
+		},
+	}, nil).Once()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	require.Len(t, event.ViolatingMetrics, 1)
+	assert.Equal(t, map[string]string{"InstanceId": "i-1"}, event.ViolatingMetrics[0].Dimensions)
+	assert.Equal(t, 1, event.Summary.Candidates)
+	mockCW.AssertExpectations(t)
+}
+
+func TestEnrich_MetricsInsightsMaxCandidates(t *testing.T) {
+	mockCW := new(CloudWatchAPIMock)
+	enricher := NewMetricAlarmEnricher(mockCW, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithMaxCandidates(2))
+
+	alarmName := "insights-cpu"
+	ts := time.Now().Add(-5 * time.Minute)
+
+	alarm := types.MetricAlarm{
+		AlarmName:          aws.String(alarmName),
+		StateValue:         types.StateValueAlarm,
+		EvaluationPeriods:  aws.Int32(1),
+		Threshold:          aws.Float64(80.0),
+		ComparisonOperator: types.ComparisonOperatorGreaterThanThreshold,
+		Metrics: []types.MetricDataQuery{{
+			Id:         aws.String("q1"),
+			Expression: aws.String(`SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId`),
+			Period:     aws.Int32(300),
+			ReturnData: aws.Bool(true),
+		}},
+	}
+
+	mockCW.On("DescribeAlarms",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		newDescribeAlarmInput(alarmName),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.DescribeAlarmsOutput{
+		MetricAlarms: []types.MetricAlarm{alarm},
+	}, nil).Twice()
+
+	var results []types.MetricDataResult
+	for _, id := range []string{"i-1", "i-2", "i-3", "i-4", "i-5"} {
+		results = append(results, types.MetricDataResult{
+			Id: aws.String("m0"), Label: aws.String(id), Values: []float64{95.0}, Timestamps: []time.Time{ts},
+			StatusCode: types.StatusCodeComplete,
+		})
+	}
+
+	mockCW.On("GetMetricData",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx != nil }),
+		mock.AnythingOfType("*cloudwatch.GetMetricDataInput"),
+		mock.AnythingOfType("[]func(*cloudwatch.Options)"),
+	).Return(&cloudwatch.GetMetricDataOutput{MetricDataResults: results}, nil).Twice()
+
+	event, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	assert.Len(t, event.ViolatingMetrics, 2)
+	assert.Equal(t, 2, event.Summary.Candidates)
+	assert.True(t, event.Partial)
+	require.Len(t, event.EnrichmentErrors, 1)
+	assert.Equal(t, events.EnrichmentCandidatesSampled, event.EnrichmentErrors[0].Reason)
+	assert.Equal(t, 3, event.EnrichmentErrors[0].Metrics)
+
+	// The same groups are sampled again.
+	again, err := enricher.Enrich(context.Background(), Request{AlarmName: alarmName})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, event.ViolatingMetrics, again.ViolatingMetrics)
+	mockCW.AssertExpectations(t)
+}
+
+func TestGroupInsightsQuery(t *testing.T) {
+	expr, keys := groupInsightsQuery(`SELECT MAX(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId, "AutoScalingGroupName" LIMIT 5`)
+	assert.Equal(t, `SELECT MAX(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId, "AutoScalingGroupName" LIMIT 5`, expr)
+	assert.Equal(t, []string{"InstanceId", "AutoScalingGroupName"}, keys)
+
+	expr, keys = groupInsightsQuery(`SELECT SUM(Errors) FROM SCHEMA("AWS/Lambda", FunctionName, Resource)`)
+	assert.Equal(t, `SELECT SUM(Errors) FROM SCHEMA("AWS/Lambda", FunctionName, Resource) GROUP BY "FunctionName", "Resource"`, expr)
+	assert.Equal(t, []string{"FunctionName", "Resource"}, keys)
+
+	expr, keys = groupInsightsQuery(`SELECT AVG(CPUUtilization) FROM "AWS/EC2"`)
+	assert.Equal(t, `SELECT AVG(CPUUtilization) FROM "AWS/EC2"`, expr)
+	assert.Empty(t, keys)
+
+	assert.Equal(t,
+		[]types.Dimension{newDimension("Service", "api|v2"), newDimension("Pod", "api-1|x")},
+		dimensionsFromInsightsLabel([]string{"Service", "Pod"}, "api|v2"+insightsLabelSeparator+"api-1|x"))
+	assert.Equal(t,
+		[]types.Dimension{newDimension("Pod", "api-1")},
+		dimensionsFromInsightsLabel([]string{"Service", "Pod"}, insightsLabelSeparator+"api-1"))
+}
+
+func TestRewriteExpression(t *testing.T) {
+	ids := map[string]string{"m1": "m0_m1", "m2": "m0_m2", "e1": "m0"}
+
+	assert.Equal(t, "m0_m1/m0_m2*100", rewriteExpression("m1/m2*100", ids))
+	assert.Equal(t, "FILL(m0_m1, 0) + m0_m2", rewriteExpression("FILL(m1, 0) + m2", ids))
+	assert.Equal(t, "IF(m0_m2 > 1e1, m0_m1)", rewriteExpression("IF(m2 > 1e1, m1)", ids))
+	assert.Equal(t, `m0_m1 + 'm2 label'`, rewriteExpression(`m1 + 'm2 label'`, ids))
+	assert.Equal(t, "m10 + m0", rewriteExpression("m10 + e1", ids))
+}
+
 func TestAlignToPeriodBoundary(t *testing.T) {
 	// 1-day period aligns to midnight UTC
 	// This is critical: CloudWatch returns NO DATA for daily metrics with misaligned time windows
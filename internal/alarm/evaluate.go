@@ -0,0 +1,181 @@
+package alarm
+
+import (
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// TreatMissingData settings. treatMissingBreaching counts empty slots as breaching; "notBreaching"
+// counts them as good; treatMissingDefault ("missing") and treatMissingIgnore leave them out.
+// treatMissingIgnore also keeps the current state when the evaluation window has no data at all.
+const (
+	treatMissingBreaching = "breaching"
+	treatMissingDefault   = "missing"
+	treatMissingIgnore    = "ignore"
+)
+
+// datapoint is a single value of a candidate's returned time series.
+type datapoint struct {
+	value     float64
+	timestamp time.Time
+	// band is the anomaly detection band at the same timestamp, if any.
+	band *events.Band
+}
+
+// evaluation is the outcome of judging a candidate's datapoints the way CloudWatch judges the alarm.
+type evaluation struct {
+	violating bool
+	// breaching is the number of datapoints in the evaluation window that breached the threshold,
+	// including missing datapoints treated as breaching.
+	breaching int
+	// evaluated is the number of datapoints in the evaluation window (EvaluationPeriods); 0 when
+	// the state was kept from the last datapoint before the window.
+	evaluated int
+	// latest is the most recent datapoint in the evaluation window; nil when the window has no data.
+	latest *datapoint
+	// lastSeen is the most recent datapoint before the evaluation window, if any was queried.
+	lastSeen *datapoint
+}
+
+// findings accumulates the outcome of evaluating an alarm's candidates.
+type findings struct {
+	// candidates is the number of resources evaluated.
+	candidates int
+	violating  []events.ViolatingMetric
+	// silent are the candidates without data in the evaluation window that reported before it;
+	// found only when data before the window is queried.
+	silent []events.ViolatingMetric
+	// healthy are the candidates with data in the evaluation window that don't violate the threshold.
+	healthy []events.ViolatingMetric
+	// incomplete counts candidates whose data CloudWatch didn't return in full.
+	incomplete int
+	// failed counts candidates whose data couldn't be fetched.
+	failed int
+	// errors records the failed batches and the incomplete candidates.
+	errors []events.EnrichmentError
+}
+
+// summary returns the impact summary of the findings. Candidates that are neither violating,
+// healthy nor incomplete had no data in the evaluation window.
+func (f *findings) summary() *events.ImpactSummary {
+	s := &events.ImpactSummary{
+		Candidates: f.candidates,
+		Violating:  len(f.violating),
+		Healthy:    len(f.healthy),
+		Incomplete: f.incomplete,
+		Failed:     f.failed,
+	}
+	s.NoData = s.Candidates - s.Violating - s.Healthy - s.Incomplete - s.Failed
+
+	if s.Candidates > 0 {
+		s.ViolatingRatio = float64(s.Violating) / float64(s.Candidates)
+	}
+
+	return s
+}
+
+// evaluationWindow returns the window CloudWatch evaluated for the alarm at the given time:
+// EvaluationPeriods full periods ending at the last period boundary.
+func evaluationWindow(alarm *types.MetricAlarm, at time.Time) events.TimeWindow {
+	period := alarmPeriod(alarm)
+	endTime := alignToPeriodBoundary(at, period)
+	startTime := endTime.Add(-period * time.Duration(aws.ToInt32(alarm.EvaluationPeriods)))
+	return events.TimeWindow{Start: startTime, End: endTime}
+}
+
+// evaluate reproduces CloudWatch's "M out of N" logic for a single candidate: the evaluation window
+// is split into EvaluationPeriods slots and the candidate violates when at least DatapointsToAlarm
+// of them breach. Empty slots are handled according to the alarm's TreatMissingData setting. When
+// the window has no data and the setting is "ignore", CloudWatch keeps the alarm in its current
+// state; the candidate keeps the state of its last datapoint before the window instead, as the
+// per-resource state is not known. A window with some data is evaluated like "missing".
+func (e *MetricAlarmEnricher) evaluate(
+	alarm *types.MetricAlarm,
+	points []datapoint,
+	window events.TimeWindow,
+) evaluation {
+	period := alarmPeriod(alarm)
+	n := int(aws.ToInt32(alarm.EvaluationPeriods))
+	m := int(aws.ToInt32(alarm.DatapointsToAlarm))
+	if m <= 0 || m > n {
+		m = n
+	}
+
+	var lastSeen *datapoint
+
+	slots := make([]*datapoint, n)
+	for i := range points {
+		p := &points[i]
+
+		if p.timestamp.Before(window.Start) {
+			if lastSeen == nil || p.timestamp.After(lastSeen.timestamp) {
+				lastSeen = p
+			}
+			continue
+		}
+
+		slot := int(p.timestamp.Sub(window.Start) / period)
+		if slot >= n {
+			continue
+		}
+
+		if slots[slot] == nil || p.timestamp.After(slots[slot].timestamp) {
+			slots[slot] = p
+		}
+	}
+
+	treatMissing := aws.ToString(alarm.TreatMissingData)
+	bandComparison := events.IsBandComparison(alarm.ComparisonOperator)
+
+	result := evaluation{evaluated: n, lastSeen: lastSeen}
+	present := 0
+
+	for _, p := range slots {
+		// Without a band there is nothing to compare an anomaly detection datapoint to.
+		if p == nil || (bandComparison && p.band == nil) {
+			if treatMissing == treatMissingBreaching {
+				result.breaching++
+			}
+			continue
+		}
+
+		present++
+		result.latest = p
+
+		if e.isViolatingThreshold(p.value, p.band, alarm) {
+			result.breaching++
+		}
+	}
+
+	if present == 0 && treatMissing != treatMissingBreaching {
+		if treatMissing == treatMissingIgnore && lastSeen != nil {
+			result.evaluated = 0
+			result.latest = lastSeen
+			result.violating = e.isViolatingThreshold(lastSeen.value, lastSeen.band, alarm)
+		}
+		return result
+	}
+
+	result.violating = n > 0 && result.breaching >= m
+
+	return result
+}
+
+// history returns the datapoints of a series in chronological order.
+func history(points []datapoint) []events.Datapoint {
+	series := make([]events.Datapoint, len(points))
+	for i, p := range points {
+		series[i] = events.Datapoint{Timestamp: p.timestamp, Value: p.value}
+	}
+
+	slices.SortFunc(series, func(a, b events.Datapoint) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	return series
+}
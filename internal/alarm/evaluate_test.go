@@ -0,0 +1,170 @@
+package alarm
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+func TestEvaluate(t *testing.T) {
+	start := time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC)
+	at := func(slot int) time.Time { return start.Add(time.Duration(slot) * time.Minute) }
+
+	tests := []struct {
+		name              string
+		datapointsToAlarm int32
+		treatMissingData  string
+		points            []datapoint
+		wantViolating     bool
+		wantBreaching     int
+		wantLatest        float64
+		// wantKept is set when the state is kept from before the window, with no slot evaluated.
+		wantKept bool
+	}{
+		{
+			name: "all datapoints breaching",
+			points: []datapoint{
+				{value: 60, timestamp: at(0)},
+				{value: 70, timestamp: at(1)},
+				{value: 80, timestamp: at(2)},
+			},
+			wantViolating: true,
+			wantBreaching: 3,
+			wantLatest:    80,
+		},
+		{
+			name: "single spike is not enough",
+			points: []datapoint{
+				{value: 10, timestamp: at(0)},
+				{value: 90, timestamp: at(1)},
+				{value: 10, timestamp: at(2)},
+			},
+			wantBreaching: 1,
+			wantLatest:    10,
+		},
+		{
+			name:              "M out of N with a dip on the latest datapoint",
+			datapointsToAlarm: 2,
+			points: []datapoint{
+				{value: 60, timestamp: at(0)},
+				{value: 70, timestamp: at(1)},
+				{value: 10, timestamp: at(2)},
+			},
+			wantViolating: true,
+			wantBreaching: 2,
+			wantLatest:    10,
+		},
+		{
+			name:             "missing datapoints treated as breaching",
+			treatMissingData: "breaching",
+			points: []datapoint{
+				{value: 60, timestamp: at(1)},
+			},
+			wantViolating: true,
+			wantBreaching: 3,
+			wantLatest:    60,
+		},
+		{
+			name:             "missing datapoints treated as not breaching",
+			treatMissingData: "notBreaching",
+			points: []datapoint{
+				{value: 60, timestamp: at(1)},
+				{value: 60, timestamp: at(2)},
+			},
+			wantBreaching: 2,
+			wantLatest:    60,
+		},
+		{
+			name:             "missing datapoints are skipped",
+			treatMissingData: "missing",
+			points: []datapoint{
+				{value: 60, timestamp: at(0)},
+				{value: 60, timestamp: at(2)},
+			},
+			wantBreaching: 2,
+			wantLatest:    60,
+		},
+		{
+			name:             "ignore keeps the breaching state of the last datapoint before the window",
+			treatMissingData: "ignore",
+			points: []datapoint{
+				{value: 10, timestamp: at(-3)},
+				{value: 90, timestamp: at(-1)},
+			},
+			wantViolating: true,
+			wantLatest:    90,
+			wantKept:      true,
+		},
+		{
+			name:             "ignore keeps the healthy state of the last datapoint before the window",
+			treatMissingData: "ignore",
+			points: []datapoint{
+				{value: 90, timestamp: at(-3)},
+				{value: 10, timestamp: at(-1)},
+			},
+			wantLatest: 10,
+			wantKept:   true,
+		},
+		{
+			name:             "ignore evaluates a window with some data like missing",
+			treatMissingData: "ignore",
+			points: []datapoint{
+				{value: 90, timestamp: at(-1)},
+				{value: 60, timestamp: at(0)},
+				{value: 60, timestamp: at(2)},
+			},
+			wantBreaching: 2,
+			wantLatest:    60,
+		},
+		{
+			name:             "ignore without any data",
+			treatMissingData: "ignore",
+		},
+		{
+			name: "datapoints outside the window are ignored",
+			points: []datapoint{
+				{value: 90, timestamp: at(-1)},
+				{value: 90, timestamp: at(3)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewMetricAlarmEnricher(nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			alarm := newMetricAlarm("test-alarm", "CPUUtilization", "AWS/EC2", types.StateValueAlarm)
+			alarm.EvaluationPeriods = aws.Int32(3)
+			if tt.datapointsToAlarm > 0 {
+				alarm.DatapointsToAlarm = aws.Int32(tt.datapointsToAlarm)
+			}
+			if tt.treatMissingData != "" {
+				alarm.TreatMissingData = aws.String(tt.treatMissingData)
+			}
+
+			result := e.evaluate(&alarm, tt.points, events.TimeWindow{Start: start, End: at(3)})
+			assert.Equal(t, tt.wantViolating, result.violating)
+			assert.Equal(t, tt.wantBreaching, result.breaching)
+			if tt.wantKept {
+				assert.Zero(t, result.evaluated)
+			} else {
+				assert.Equal(t, 3, result.evaluated)
+			}
+
+			if tt.wantLatest == 0 {
+				assert.Nil(t, result.latest)
+				return
+			}
+			require.NotNil(t, result.latest)
+			assert.Equal(t, tt.wantLatest, result.latest.value)
+		})
+	}
+}
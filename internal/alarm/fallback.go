@@ -0,0 +1,61 @@
+package alarm
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// FallbackEvent builds an event from the state change payload of a request whose enrichment
+// failed with err, so that the alarm is still notified. It describes the alarm only as far as the
+// payload does and lists no metrics. Transitions from ALARM to OK are still reported as recoveries,
+// without the resources they resolved.
+func FallbackEvent(req Request, err error) *events.EnrichedEvent {
+	now := time.Now()
+	recoveredAt := req.StateChangedAt
+	if recoveredAt.IsZero() {
+		recoveredAt = now
+	}
+
+	// A recovery whose start cannot be told is notified as a plain state change.
+	recovery, _ := recoveryFromStateChange(req.StateChange, recoveredAt)
+
+	event := &events.EnrichedEvent{
+		AccountID:         req.AccountID,
+		Region:            req.Region,
+		Timestamp:         now,
+		Recovery:          recovery,
+		StateChange:       req.StateChange,
+		ViolatingMetrics:  []events.ViolatingMetric{},
+		Partial:           true,
+		EnrichmentFailure: err.Error(),
+	}
+
+	alarm, composite, ok := alarmFromStateChange(req.StateChange)
+	switch {
+	case ok:
+		event.Alarm = alarm
+		event.CompositeAlarm = composite
+	default:
+		event.Alarm = &types.MetricAlarm{AlarmName: aws.String(req.AlarmName)}
+		if sc := req.StateChange; sc != nil {
+			event.Alarm.AlarmDescription = optionalString(sc.Configuration.Description)
+			event.Alarm.StateValue = sc.State.Value
+			event.Alarm.StateReason = aws.String(sc.State.Reason)
+		}
+	}
+
+	if req.AlarmARN != "" {
+		switch {
+		case event.Alarm != nil:
+			event.Alarm.AlarmArn = aws.String(req.AlarmARN)
+		case event.CompositeAlarm != nil:
+			event.CompositeAlarm.AlarmArn = aws.String(req.AlarmARN)
+		}
+	}
+
+	return event
+}
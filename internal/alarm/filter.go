@@ -0,0 +1,122 @@
+package alarm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// DimensionRule matches metrics by the value of one of their dimensions: exactly, or against a
+// regular expression when Pattern is set.
+type DimensionRule struct {
+	Name    string
+	Value   string
+	Pattern *regexp.Regexp
+}
+
+// Matches reports whether the metric has the dimension with a matching value.
+func (r DimensionRule) Matches(dimensions []types.Dimension) bool {
+	for _, d := range dimensions {
+		if aws.ToString(d.Name) != r.Name {
+			continue
+		}
+
+		value := aws.ToString(d.Value)
+		if r.Pattern != nil {
+			return r.Pattern.MatchString(value)
+		}
+		return value == r.Value
+	}
+
+	return false
+}
+
+// String describes the rule in the form ParseDimensionRules accepts.
+func (r DimensionRule) String() string {
+	if r.Pattern != nil {
+		return r.Name + "=/" + r.Pattern.String() + "/"
+	}
+	return r.Name + "=" + r.Value
+}
+
+// ParseDimensionRules parses space-separated rules of the form "Name=value", or "Name=/regexp/"
+// to match values against an unanchored regular expression, e.g.
+// "Namespace=kube-system PodName=/^debug-/".
+func ParseDimensionRules(s string) ([]DimensionRule, error) {
+	var rules []DimensionRule
+
+	for _, field := range strings.Fields(s) {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid dimension rule %q: want Name=value", field)
+		}
+
+		rule := DimensionRule{Name: name, Value: value}
+
+		if len(value) >= 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+			pattern, err := regexp.Compile(value[1 : len(value)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid dimension rule %q: %w", field, err)
+			}
+			rule = DimensionRule{Name: name, Pattern: pattern}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// dimensionFilter keeps the metrics that match the include rules and none of the exclude rules.
+// Include rules on the same dimension are alternatives; those on different dimensions must all
+// match, so metrics without a dimension some include rule names are dropped.
+type dimensionFilter struct {
+	include []DimensionRule
+	exclude []DimensionRule
+}
+
+// empty reports whether the filter keeps every metric.
+func (f dimensionFilter) empty() bool {
+	return len(f.include) == 0 && len(f.exclude) == 0
+}
+
+// apply returns the metrics the filter keeps. Metrics with no more than least dimensions are the
+// alarm metric itself rather than one of its resources, and are always kept.
+func (f dimensionFilter) apply(metrics []*types.Metric, least int) []*types.Metric {
+	if f.empty() {
+		return metrics
+	}
+
+	var kept []*types.Metric
+	for _, m := range metrics {
+		if len(m.Dimensions) <= least || f.keeps(m.Dimensions) {
+			kept = append(kept, m)
+		}
+	}
+
+	return kept
+}
+
+func (f dimensionFilter) keeps(dimensions []types.Dimension) bool {
+	for _, r := range f.exclude {
+		if r.Matches(dimensions) {
+			return false
+		}
+	}
+
+	// Group include rules by dimension: any rule of a dimension may match.
+	matched := make(map[string]bool)
+	for _, r := range f.include {
+		matched[r.Name] = matched[r.Name] || r.Matches(dimensions)
+	}
+	for _, ok := range matched {
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,81 @@
+package alarm
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func podMetrics() []*types.Metric {
+	pods := []struct{ namespace, pod, env string }{
+		{"kube-system", "coredns-1", "prod"},
+		{"default", "api-1", "prod"},
+		{"default", "debug-api-1", "prod"},
+		{"default", "api-2", "staging"},
+		{"default", "api-3", "dev"},
+	}
+
+	metrics := make([]*types.Metric, len(pods))
+	for i, p := range pods {
+		m := newMetric("pod_cpu_utilization", "ContainerInsights", []types.Dimension{
+			newDimension("ClusterName", "main"),
+			newDimension("Namespace", p.namespace),
+			newDimension("PodName", p.pod),
+			newDimension("Environment", p.env),
+		})
+		metrics[i] = &m
+	}
+	return metrics
+}
+
+func TestDimensionFilter(t *testing.T) {
+	parse := func(s string) []DimensionRule {
+		rules, err := ParseDimensionRules(s)
+		require.NoError(t, err)
+		return rules
+	}
+
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		want    []string
+	}{
+		{"no rules", "", "", []string{"coredns-1", "api-1", "debug-api-1", "api-2", "api-3"}},
+		{"exclude", "", "Namespace=kube-system", []string{"api-1", "debug-api-1", "api-2", "api-3"}},
+		{"exclude regexp", "", "Namespace=kube-system PodName=/^debug-/", []string{"api-1", "api-2", "api-3"}},
+		{"include", "Environment=prod", "", []string{"coredns-1", "api-1", "debug-api-1"}},
+		{"include alternatives", "Environment=prod Environment=staging", "Namespace=kube-system", []string{"api-1", "debug-api-1", "api-2"}},
+		{"include all dimensions", "Environment=/^(prod|dev)$/ PodName=/api-[13]/", "", []string{"api-1", "debug-api-1", "api-3"}},
+		{"include missing dimension", "Team=payments", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := dimensionFilter{include: parse(tt.include), exclude: parse(tt.exclude)}
+			assert.Equal(t, tt.want, dimensionValues(f.apply(podMetrics(), 1), "PodName"))
+		})
+	}
+}
+
+func TestDimensionFilter_KeepsAlarmMetric(t *testing.T) {
+	alarmMetric := newMetric("CPUUtilization", "AWS/EC2", []types.Dimension{newDimension("AutoScalingGroupName", "web")})
+
+	f := dimensionFilter{include: []DimensionRule{{Name: "InstanceId", Value: "i-a"}}}
+	assert.Len(t, f.apply([]*types.Metric{&alarmMetric}, 1), 1)
+}
+
+func TestParseDimensionRules(t *testing.T) {
+	rules, err := ParseDimensionRules("Namespace=kube-system  PodName=/^debug-/")
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, DimensionRule{Name: "Namespace", Value: "kube-system"}, rules[0])
+	assert.Equal(t, "PodName=/^debug-/", rules[1].String())
+
+	for _, in := range []string{"Namespace", "=value", "PodName=/[/"} {
+		_, err := ParseDimensionRules(in)
+		assert.Error(t, err, in)
+	}
+}
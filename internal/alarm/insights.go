@@ -0,0 +1,276 @@
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// insightsLabelSeparator separates dimension values in the dynamic label requested for
+// Metrics Insights results. CloudWatch only accepts ASCII dimension values, so a non-ASCII
+// separator cannot be mistaken for part of a value.
+const insightsLabelSeparator = "\u241f"
+
+var (
+	insightsSelect  = regexp.MustCompile(`(?i)^\s*SELECT\b`)
+	insightsGroupBy = regexp.MustCompile(`(?is)\bGROUP\s+BY\s+(.+?)(?:\s+ORDER\s+BY\b|\s+LIMIT\b|$)`)
+	insightsTail    = regexp.MustCompile(`(?is)\s+(?:ORDER\s+BY|LIMIT)\b`)
+	insightsSchema  = regexp.MustCompile(`(?is)\bSCHEMA\s*\(([^)]*)\)`)
+)
+
+// insightsQuery returns the Metrics Insights query an alarm is built on, if any.
+func insightsQuery(alarm *types.MetricAlarm) *types.MetricDataQuery {
+	for i, q := range alarm.Metrics {
+		if insightsSelect.MatchString(aws.ToString(q.Expression)) {
+			return &alarm.Metrics[i]
+		}
+	}
+	return nil
+}
+
+// findInsightsViolations re-runs an alarm's Metrics Insights query with its GROUP BY keys preserved
+// and evaluates every returned group as a separate resource. Queries without GROUP BY are grouped
+// by the dimension keys of their SCHEMA so that the alarm can still be broken down per resource.
+// When a page after the first fails with a retryable error, the groups already returned are still
+// evaluated and the failure is recorded in the findings.
+func (e *MetricAlarmEnricher) findInsightsViolations(
+	ctx context.Context,
+	alarm *types.MetricAlarm,
+	query *types.MetricDataQuery,
+	window events.TimeWindow,
+) (*findings, error) {
+	ctx, span := tracer.Start(ctx, "alarm.insights_query")
+	defer span.End()
+
+	expr, keys := groupInsightsQuery(aws.ToString(query.Expression))
+	span.SetAttributes(attribute.StringSlice("insights.group_by", keys))
+
+	period := alarmPeriod(alarm)
+
+	dataQuery := types.MetricDataQuery{
+		Id:         aws.String(candidateQueryID(0)),
+		Expression: aws.String(expr),
+		Period:     aws.Int32(int32(period.Seconds())),
+		ReturnData: aws.Bool(true),
+	}
+	if len(keys) > 0 {
+		dataQuery.Label = aws.String(insightsLabel(keys))
+	}
+
+	paginator := cloudwatch.NewGetMetricDataPaginator(e.cw, &cloudwatch.GetMetricDataInput{
+		MetricDataQueries: []types.MetricDataQuery{dataQuery},
+		StartTime:         aws.Time(e.queryStart(alarm, window)),
+		EndTime:           aws.Time(window.End),
+	})
+
+	// Every group comes back as its own series with the same query ID; the label tells them apart.
+	type seriesData struct {
+		points   []datapoint
+		complete bool
+	}
+
+	series := make(map[string]*seriesData)
+	var (
+		labels  []string
+		pageErr error
+	)
+
+	for paginator.HasMorePages() {
+		if err := e.waitForRate(ctx); err != nil {
+			return nil, err
+		}
+
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			err = fmt.Errorf("cannot get metrics insights data on next page: %w", err)
+			if isFatal(err) || len(labels) == 0 {
+				return nil, err
+			}
+
+			e.logger.WarnContext(ctx, "cannot get metrics insights data; evaluating the groups returned so far",
+				slog.String("alarmName", aws.ToString(alarm.AlarmName)),
+				slog.String("error", err.Error()))
+			pageErr = err
+			break
+		}
+
+		for _, result := range page.MetricDataResults {
+			label := aws.ToString(result.Label)
+			if series[label] == nil {
+				series[label] = &seriesData{}
+				labels = append(labels, label)
+			}
+
+			for i, v := range result.Values {
+				series[label].points = append(series[label].points, datapoint{value: v, timestamp: result.Timestamps[i]})
+			}
+
+			if result.StatusCode == types.StatusCodeComplete {
+				series[label].complete = true
+			}
+		}
+	}
+
+	span.SetAttributes(attribute.Int("insights.series_count", len(labels)))
+
+	// The groups are filtered like the metrics other alarms are drilled down to. The query can't be
+	// narrowed down beforehand, so filtered groups are still queried but not reported.
+	if !e.dimensionFilter.empty() && len(keys) > 0 {
+		labels = slices.DeleteFunc(labels, func(label string) bool {
+			return !e.dimensionFilter.keeps(dimensionsFromInsightsLabel(keys, label))
+		})
+	}
+
+	// The groups are capped like the metrics other alarms are drilled down to.
+	groups := make([]*types.Metric, len(labels))
+	groupLabels := make(map[*types.Metric]string, len(labels))
+	for i, label := range labels {
+		groups[i] = &types.Metric{Dimensions: dimensionsFromInsightsLabel(keys, label)}
+		groupLabels[groups[i]] = label
+	}
+
+	groups, sampledOut := e.sample(groups, nil)
+
+	found := &findings{candidates: len(groups)}
+	if sampledOut > 0 {
+		found.errors = append(found.errors, e.sampledError(sampledOut))
+	}
+	if pageErr != nil {
+		found.errors = append(found.errors, events.EnrichmentError{
+			Reason:  events.EnrichmentBatchFailed,
+			Message: pageErr.Error(),
+		})
+	}
+
+	var incomplete []map[string]string
+
+	for _, group := range groups {
+		label := groupLabels[group]
+		data := series[label]
+		metric := *group
+
+		if !data.complete {
+			e.logger.WarnContext(ctx, "metrics insights data incomplete after pagination",
+				slog.String("label", label))
+			found.incomplete++
+			incomplete = append(incomplete, dimensionsMap(metric.Dimensions))
+			continue
+		}
+
+		result := e.evaluate(alarm, data.points, window)
+
+		if !result.violating {
+			switch {
+			case result.latest != nil:
+				found.healthy = append(found.healthy, e.createViolatingMetric(metric, result))
+			case result.lastSeen != nil:
+				found.silent = append(found.silent, e.createSilentMetric(metric, result, data.points))
+			}
+			continue
+		}
+
+		vm := e.createViolatingMetric(metric, result)
+		if e.history {
+			vm.History = history(data.points)
+		}
+		found.violating = append(found.violating, vm)
+	}
+
+	if len(incomplete) > 0 {
+		found.errors = append(found.errors, events.EnrichmentError{
+			Reason:     events.EnrichmentDataIncomplete,
+			Metrics:    len(incomplete),
+			Dimensions: incomplete,
+		})
+	}
+
+	return found, nil
+}
+
+// groupInsightsQuery returns the query grouped per resource along with its GROUP BY keys.
+// Queries that already group are returned unchanged; otherwise the SCHEMA dimension keys are
+// added as GROUP BY ahead of any ORDER BY or LIMIT clause.
+func groupInsightsQuery(expr string) (string, []string) {
+	if m := insightsGroupBy.FindStringSubmatch(expr); m != nil {
+		return expr, splitInsightsKeys(m[1])
+	}
+
+	m := insightsSchema.FindStringSubmatch(expr)
+	if m == nil {
+		return expr, nil
+	}
+
+	// The first SCHEMA argument is the namespace.
+	keys := splitInsightsKeys(m[1])
+	if len(keys) < 2 {
+		return expr, nil
+	}
+	keys = keys[1:]
+
+	groupBy := " GROUP BY " + strings.Join(quoteInsightsKeys(keys), ", ")
+	if loc := insightsTail.FindStringIndex(expr); loc != nil {
+		return expr[:loc[0]] + groupBy + expr[loc[0]:], keys
+	}
+
+	return strings.TrimSpace(expr) + groupBy, keys
+}
+
+func splitInsightsKeys(s string) []string {
+	var keys []string
+	for _, k := range strings.Split(s, ",") {
+		k = strings.Trim(strings.TrimSpace(k), `"`)
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func quoteInsightsKeys(keys []string) []string {
+	quoted := make([]string, len(keys))
+	for i, k := range keys {
+		quoted[i] = `"` + k + `"`
+	}
+	return quoted
+}
+
+// insightsLabel builds a dynamic label that renders the value of every GROUP BY key.
+func insightsLabel(keys []string) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = "${PROP('Dim." + k + "')}"
+	}
+	return strings.Join(parts, insightsLabelSeparator)
+}
+
+// dimensionsFromInsightsLabel maps a result label produced by insightsLabel back to dimensions.
+func dimensionsFromInsightsLabel(keys []string, label string) []types.Dimension {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	values := strings.SplitN(label, insightsLabelSeparator, len(keys))
+	dimensions := make([]types.Dimension, 0, len(keys))
+
+	for i, k := range keys {
+		if i >= len(values) || values[i] == "" {
+			continue
+		}
+		dimensions = append(dimensions, types.Dimension{
+			Name:  aws.String(k),
+			Value: aws.String(values[i]),
+		})
+	}
+
+	return dimensions
+}
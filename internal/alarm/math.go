@@ -0,0 +1,225 @@
+package alarm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// unexpandableExpression matches metric math functions that operate on the whole request or on
+// dynamically discovered metrics, which can't be rebuilt per resource.
+var unexpandableExpression = regexp.MustCompile(`(?i)\b(SEARCH|METRICS)\s*\(`)
+
+// findMetricMathCandidates expands an alarm defined through metric queries into one candidate per resource.
+// Every MetricStat leg is drilled down to its most detailed metrics; legs are matched on the dimensions
+// they add beyond the alarm's own, and the expressions are rebuilt for each matching dimension set.
+// Legs that can't be drilled down are shared by all candidates. For anomaly detection alarms the
+// ANOMALY_DETECTION_BAND expression is rebuilt per candidate as well, so each resource is judged
+// against its own band.
+func (e *MetricAlarmEnricher) findMetricMathCandidates(
+	ctx context.Context,
+	alarm *types.MetricAlarm,
+	d *discovery,
+) ([]candidate, error) {
+	returnID, err := returnQueryID(alarm)
+	if err != nil {
+		return nil, err
+	}
+
+	// Anomaly detection alarms compare against a band expression instead of a static threshold;
+	// it is returned alongside each candidate's value.
+	thresholdID := aws.ToString(alarm.ThresholdMetricId)
+
+	for _, q := range alarm.Metrics {
+		if expr := aws.ToString(q.Expression); expr != "" && unexpandableExpression.MatchString(expr) {
+			e.logger.WarnContext(ctx, "metric math expression cannot be expanded per resource; skipping violation analysis",
+				slog.String("alarmName", aws.ToString(alarm.AlarmName)),
+				slog.String("expression", expr))
+			return nil, nil
+		}
+	}
+
+	type leg struct {
+		metrics map[string]*types.Metric
+		shared  *types.Metric
+	}
+
+	legs := make(map[string]*leg)
+	var keys []string
+
+	for _, q := range alarm.Metrics {
+		if q.MetricStat == nil || q.MetricStat.Metric == nil {
+			continue
+		}
+
+		legMetric := q.MetricStat.Metric
+		metrics, err := e.drillDown(
+			ctx,
+			d,
+			aws.ToString(legMetric.Namespace),
+			aws.ToString(legMetric.MetricName),
+			toDimensionFilters(legMetric.Dimensions),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(metrics) == 0 {
+			return nil, nil
+		}
+
+		l := &leg{metrics: make(map[string]*types.Metric, len(metrics))}
+		var legKeys []string
+		for _, m := range metrics {
+			key := dimensionKey(m.Dimensions, legMetric.Dimensions)
+			if _, ok := l.metrics[key]; !ok {
+				l.metrics[key] = m
+				legKeys = append(legKeys, key)
+			}
+		}
+
+		if len(legKeys) == 1 && legKeys[0] == "" {
+			l.shared = l.metrics[""]
+		} else if keys == nil {
+			keys = legKeys
+		} else {
+			keys = intersectKeys(keys, l.metrics)
+		}
+
+		legs[aws.ToString(q.Id)] = l
+	}
+
+	// No leg could be drilled down: evaluate the alarm as a whole.
+	if keys == nil {
+		keys = []string{""}
+	}
+
+	var candidates []candidate
+
+	for _, key := range keys {
+		idx := len(candidates)
+		prefix := candidateQueryID(idx)
+
+		ids := make(map[string]string, len(alarm.Metrics))
+		for _, q := range alarm.Metrics {
+			id := aws.ToString(q.Id)
+			switch id {
+			case returnID:
+				ids[id] = prefix
+			case thresholdID:
+				ids[id] = bandQueryID(idx)
+			default:
+				ids[id] = prefix + "_" + id
+			}
+		}
+
+		c := candidate{}
+		for _, q := range alarm.Metrics {
+			id := aws.ToString(q.Id)
+			query := types.MetricDataQuery{
+				Id:         aws.String(ids[id]),
+				Period:     q.Period,
+				ReturnData: aws.Bool(id == returnID || id == thresholdID),
+			}
+
+			if q.MetricStat != nil && q.MetricStat.Metric != nil {
+				l := legs[id]
+				metric := l.shared
+				if metric == nil {
+					metric = l.metrics[key]
+				}
+
+				if c.metric == nil || (l.shared == nil && len(metric.Dimensions) > len(c.metric.Dimensions)) {
+					c.metric = metric
+				}
+
+				stat := *q.MetricStat
+				stat.Metric = metric
+				query.MetricStat = &stat
+			} else {
+				query.Expression = aws.String(rewriteExpression(aws.ToString(q.Expression), ids))
+			}
+
+			c.queries = append(c.queries, query)
+		}
+
+		if c.metric == nil {
+			c.metric = &types.Metric{}
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
+
+// returnQueryID returns the ID of the alarm query whose result is compared against the threshold.
+func returnQueryID(alarm *types.MetricAlarm) (string, error) {
+	for _, q := range alarm.Metrics {
+		id := aws.ToString(q.Id)
+		if aws.ToBool(q.ReturnData) && id != aws.ToString(alarm.ThresholdMetricId) {
+			return id, nil
+		}
+	}
+	return "", errors.New("no metric query returns data")
+}
+
+// intersectKeys keeps the keys, in order, that are also present in metrics.
+func intersectKeys(keys []string, metrics map[string]*types.Metric) []string {
+	kept := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if _, ok := metrics[k]; ok {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
+
+// rewriteExpression replaces the query IDs referenced by a metric math expression according to ids.
+// Quoted strings are left untouched.
+func rewriteExpression(expr string, ids map[string]string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				sb.WriteString(expr[i:])
+				return sb.String()
+			}
+			sb.WriteString(expr[i : i+end+2])
+			i += end + 2
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			start := i
+			for i < len(expr) && isIdentByte(expr[i]) {
+				i++
+			}
+
+			word := expr[start:i]
+			if id, ok := ids[word]; ok {
+				word = id
+			}
+			sb.WriteString(word)
+		case c >= '0' && c <= '9':
+			// Numeric literals such as 1e5 must not be mistaken for a query ID.
+			start := i
+			for i < len(expr) && (isIdentByte(expr[i]) || expr[i] == '.') {
+				i++
+			}
+			sb.WriteString(expr[start:i])
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+
+	return sb.String()
+}
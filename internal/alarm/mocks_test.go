@@ -35,3 +35,24 @@ func (m *CloudWatchAPIMock) GetMetricData(ctx context.Context, params *cloudwatc
 	}
 	return args.Get(0).(*cloudwatch.GetMetricDataOutput), args.Error(1)
 }
+
+func (m *CloudWatchAPIMock) ListTagsForResource(ctx context.Context, params *cloudwatch.ListTagsForResourceInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.ListTagsForResourceOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*cloudwatch.ListTagsForResourceOutput), args.Error(1)
+}
+
+// ClientProviderMock is a mock implementation of the ClientProvider interface.
+type ClientProviderMock struct {
+	mock.Mock
+}
+
+func (m *ClientProviderMock) Client(ctx context.Context, accountID, region string) (CloudWatchAPI, error) {
+	args := m.Called(ctx, accountID, region)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(CloudWatchAPI), args.Error(1)
+}
@@ -0,0 +1,83 @@
+package alarm
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Alarm tags overriding the enricher's configuration for an alarm.
+const (
+	// TagDrillDown overrides the drill-down strategy, in the form ParseDrillDownStrategy accepts,
+	// e.g. "keys:ServiceName".
+	TagDrillDown = "enricher:drill-down"
+	// TagInclude and TagExclude override the include and exclude rules of the dimension filter, in
+	// the form ParseDimensionRules accepts, e.g. "Namespace=kube-system".
+	TagInclude = "enricher:include"
+	TagExclude = "enricher:exclude"
+)
+
+// forAlarm returns the enricher configured for alarm: a copy with the overrides its tags set when
+// alarm overrides are enabled, the enricher itself otherwise. Overrides are a refinement, so
+// failing to read them is logged and the enricher's own configuration is used.
+func (e *MetricAlarmEnricher) forAlarm(ctx context.Context, alarm *types.MetricAlarm) *MetricAlarmEnricher {
+	if !e.alarmOverrides {
+		return e
+	}
+
+	alarmName := aws.ToString(alarm.AlarmName)
+
+	if alarm.AlarmArn == nil {
+		e.logger.DebugContext(ctx, "alarm ARN unknown; skipping alarm overrides",
+			slog.String("alarmName", alarmName))
+		return e
+	}
+
+	output, err := e.cw.ListTagsForResource(ctx, &cloudwatch.ListTagsForResourceInput{
+		ResourceARN: alarm.AlarmArn,
+	})
+	if err != nil {
+		e.logger.WarnContext(ctx, "cannot list alarm tags; skipping alarm overrides",
+			slog.String("alarmName", alarmName),
+			slog.String("error", err.Error()))
+		return e
+	}
+
+	scoped := *e
+
+	for _, tag := range output.Tags {
+		key, value := aws.ToString(tag.Key), aws.ToString(tag.Value)
+
+		var err error
+
+		switch key {
+		case TagDrillDown:
+			var strategy DrillDownStrategy
+			if strategy, err = ParseDrillDownStrategy(value); err == nil {
+				scoped.drillDownStrategy = strategy
+			}
+		case TagInclude:
+			var rules []DimensionRule
+			if rules, err = ParseDimensionRules(value); err == nil {
+				scoped.dimensionFilter.include = rules
+			}
+		case TagExclude:
+			var rules []DimensionRule
+			if rules, err = ParseDimensionRules(value); err == nil {
+				scoped.dimensionFilter.exclude = rules
+			}
+		}
+
+		if err != nil {
+			e.logger.WarnContext(ctx, "invalid alarm override; ignoring it",
+				slog.String("alarmName", alarmName),
+				slog.String("tag", key),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	return &scoped
+}
@@ -0,0 +1,102 @@
+package alarm
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// rankViolatingMetrics computes how far each violating metric is beyond the alarm threshold and
+// sorts them most severe first: by relative distance, then absolute distance, then dimensions,
+// so that the order is deterministic.
+func rankViolatingMetrics(alarm *types.MetricAlarm, metrics []events.ViolatingMetric) {
+	for i := range metrics {
+		vm := &metrics[i]
+		vm.Distance, vm.RelativeDistance = thresholdDistance(alarm, vm.Value, vm.Band)
+	}
+
+	slices.SortStableFunc(metrics, func(a, b events.ViolatingMetric) int {
+		return cmp.Or(
+			cmp.Compare(b.RelativeDistance, a.RelativeDistance),
+			cmp.Compare(b.Distance, a.Distance),
+			cmp.Compare(violatingMetricKey(a), violatingMetricKey(b)),
+		)
+	})
+}
+
+// rankSilentMetrics sorts metrics that stopped reporting by the time they were last seen, the
+// longest silent first, then by dimensions.
+func rankSilentMetrics(metrics []events.ViolatingMetric) []events.ViolatingMetric {
+	slices.SortStableFunc(metrics, func(a, b events.ViolatingMetric) int {
+		return cmp.Or(
+			a.Timestamp.Compare(b.Timestamp),
+			cmp.Compare(violatingMetricKey(a), violatingMetricKey(b)),
+		)
+	})
+
+	return metrics
+}
+
+// thresholdDistance returns how far value is beyond the threshold in the breaching direction,
+// and that distance relative to the threshold, or to the band width for anomaly detection alarms.
+// Values on the good side of the threshold have a negative distance. The relative distance is
+// zero when there is nothing to relate to, i.e. a zero threshold or band width.
+func thresholdDistance(alarm *types.MetricAlarm, value float64, band *events.Band) (float64, float64) {
+	threshold := aws.ToFloat64(alarm.Threshold)
+
+	var distance, scale float64
+
+	switch alarm.ComparisonOperator {
+	case types.ComparisonOperatorGreaterThanThreshold, types.ComparisonOperatorGreaterThanOrEqualToThreshold:
+		distance, scale = value-threshold, math.Abs(threshold)
+	case types.ComparisonOperatorLessThanThreshold, types.ComparisonOperatorLessThanOrEqualToThreshold:
+		distance, scale = threshold-value, math.Abs(threshold)
+	case types.ComparisonOperatorGreaterThanUpperThreshold:
+		if band == nil {
+			return 0, 0
+		}
+		distance, scale = value-band.Upper, band.Upper-band.Lower
+	case types.ComparisonOperatorLessThanLowerThreshold:
+		if band == nil {
+			return 0, 0
+		}
+		distance, scale = band.Lower-value, band.Upper-band.Lower
+	case types.ComparisonOperatorLessThanLowerOrGreaterThanUpperThreshold:
+		if band == nil {
+			return 0, 0
+		}
+		distance, scale = max(value-band.Upper, band.Lower-value), band.Upper-band.Lower
+	default:
+		return 0, 0
+	}
+
+	if scale == 0 {
+		return distance, 0
+	}
+
+	return distance, distance / scale
+}
+
+// violatingMetricKey renders the dimensions of a violating metric in a canonical form.
+func violatingMetricKey(vm events.ViolatingMetric) string {
+	names := make([]string, 0, len(vm.Dimensions))
+	for name := range vm.Dimensions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var key []byte
+	for _, name := range names {
+		key = append(key, name...)
+		key = append(key, '=')
+		key = append(key, vm.Dimensions[name]...)
+		key = append(key, ',')
+	}
+
+	return string(key)
+}
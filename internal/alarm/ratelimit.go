@@ -0,0 +1,42 @@
+package alarm
+
+import (
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiters hands out one GetMetricData rate limiter per account and region, since CloudWatch
+// quotas apply to each account and region on its own. Limiters are created on first use and kept
+// for the lifetime of the enricher, so warm invocations keep pacing where the last one left off.
+type rateLimiters struct {
+	limit rate.Limit
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newRateLimiters(tps float64, burst int) *rateLimiters {
+	return &rateLimiters{
+		limit:    rate.Limit(tps),
+		burst:    max(burst, 1),
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// limiter returns the limiter of an account and region. Empty values stand for the enricher's
+// own account and region.
+func (l *rateLimiters) limiter(accountID, region string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := accountID + "/" + region
+	limiter, ok := l.limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.limiters[key] = limiter
+	}
+
+	return limiter
+}
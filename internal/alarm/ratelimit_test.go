@@ -0,0 +1,17 @@
+package alarm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiters(t *testing.T) {
+	limiters := newRateLimiters(10, 0)
+
+	home := limiters.limiter("111111111111", "eu-north-1")
+	assert.Same(t, home, limiters.limiter("111111111111", "eu-north-1"))
+	assert.NotSame(t, home, limiters.limiter("222222222222", "eu-north-1"), "accounts are paced apart")
+	assert.NotSame(t, home, limiters.limiter("111111111111", "us-east-1"), "regions are paced apart")
+	assert.Equal(t, 1, home.Burst())
+}
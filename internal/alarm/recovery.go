@@ -0,0 +1,126 @@
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// recovery returns the incident a request ends when it describes a transition from ALARM to OK
+// state, and nil otherwise.
+func (e *MetricAlarmEnricher) recovery(ctx context.Context, req Request, recoveredAt time.Time) *events.Recovery {
+	recovery, err := recoveryFromStateChange(req.StateChange, recoveredAt)
+	if err != nil {
+		e.logger.WarnContext(ctx, "cannot parse previous alarm state timestamp; not reporting recovery",
+			slog.String("alarmName", req.AlarmName),
+			slog.String("timestamp", req.StateChange.PreviousState.Timestamp),
+			slog.String("error", err.Error()))
+		return nil
+	}
+
+	return recovery
+}
+
+// recoveryFromStateChange returns the incident a state change ends when it is a transition from
+// ALARM to OK state, and nil otherwise. The incident starts when the previous state was entered,
+// so state changes without the previous state's timestamp are not treated as recoveries.
+func recoveryFromStateChange(sc *events.AlarmStateChange, recoveredAt time.Time) (*events.Recovery, error) {
+	if sc == nil || sc.State.Value != types.StateValueOk || sc.PreviousState.Value != types.StateValueAlarm {
+		return nil, nil
+	}
+
+	alarmedAt, err := sc.PreviousState.Time()
+	if err != nil {
+		return nil, err
+	}
+
+	return &events.Recovery{
+		AlarmedAt:       alarmedAt,
+		RecoveredAt:     recoveredAt,
+		DurationSeconds: int64(recoveredAt.Sub(alarmedAt).Seconds()),
+	}, nil
+}
+
+// enrichRecovery finds the resources a recovered metric alarm's incident resolved: it evaluates
+// the window that raised the alarm and the window that cleared it, and reports the metrics that
+// violated the threshold in the former and are healthy in the latter. The analysis returned
+// describes the window that cleared the alarm.
+func (e *MetricAlarmEnricher) enrichRecovery(
+	ctx context.Context,
+	alarm *types.MetricAlarm,
+	recovery *events.Recovery,
+) (*metricAnalysis, error) {
+	alarmName := aws.ToString(alarm.AlarmName)
+	e = e.forAlarm(ctx, alarm)
+
+	alarmWindow := evaluationWindow(alarm, recovery.AlarmedAt)
+	recovery.AlarmWindow = &alarmWindow
+
+	before, err := e.findViolatingMetrics(ctx, alarm, alarmWindow)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find violating metrics of alarm %q when it was raised: %w", alarmName, err)
+	}
+
+	window := evaluationWindow(alarm, recovery.RecoveredAt)
+
+	after, err := e.findViolatingMetrics(ctx, alarm, window)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find violating metrics of alarm %q when it recovered: %w", alarmName, err)
+	}
+
+	healthy := make(map[string]events.ViolatingMetric, len(after.healthy))
+	for _, vm := range after.healthy {
+		healthy[violatingMetricKey(vm)] = vm
+	}
+
+	violating := make(map[string]bool, len(after.violating))
+	for _, vm := range after.violating {
+		violating[violatingMetricKey(vm)] = true
+	}
+
+	rankViolatingMetrics(alarm, before.violating)
+
+	var resolved []events.ViolatingMetric
+	for _, vm := range before.violating {
+		key := violatingMetricKey(vm)
+
+		if now, ok := healthy[key]; ok {
+			now.Distance, now.RelativeDistance = thresholdDistance(alarm, now.Value, now.Band)
+			resolved = append(resolved, now)
+			continue
+		}
+
+		if violating[key] {
+			recovery.StillViolating++
+		}
+	}
+
+	resolved, recovery.OmittedResolvedMetrics = e.truncate(resolved)
+	e.resolveTags(ctx, alarm, resolved)
+	recovery.ResolvedMetrics = resolved
+
+	e.logger.InfoContext(
+		ctx,
+		"evaluated alarm recovery",
+		slog.String("alarmName", alarmName),
+		slog.Int("violatingWhenRaised", len(before.violating)),
+		slog.Int("resolved", len(resolved)+recovery.OmittedResolvedMetrics),
+		slog.Int("stillViolating", recovery.StillViolating),
+	)
+
+	return &metricAnalysis{
+		window:    &window,
+		violating: []events.ViolatingMetric{},
+		summary:   after.summary(),
+		// The windows may list different candidates, as only recent ones are limited to recently
+		// active metrics, so the errors of both are kept, including how many they sampled out.
+		errors: append(slices.Clone(before.errors), after.errors...),
+	}, nil
+}
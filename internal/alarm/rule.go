@@ -0,0 +1,159 @@
+package alarm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// parseAlarmRule extracts the alarm names referenced by a composite alarm rule, in order of first appearance.
+// It understands the ALARM, OK and INSUFFICIENT_DATA state functions as well as AT_LEAST lists.
+// Alarm ARNs are reduced to their alarm names.
+func parseAlarmRule(rule string) []string {
+	p := &ruleParser{input: rule, seen: make(map[string]bool)}
+	p.parse()
+	return p.names
+}
+
+type ruleParser struct {
+	input string
+	pos   int
+	names []string
+	seen  map[string]bool
+}
+
+func (p *ruleParser) parse() {
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+
+		switch {
+		case c == '"':
+			p.readQuoted()
+		case isIdentByte(c):
+			word := p.readIdent()
+			p.skipSpaces()
+			if p.pos >= len(p.input) || p.input[p.pos] != '(' {
+				continue
+			}
+
+			switch word {
+			case "ALARM", "OK", "INSUFFICIENT_DATA":
+				p.pos++
+				p.add(p.readArg())
+			case "AT_LEAST":
+				p.pos++
+				p.readAtLeastList()
+			}
+		default:
+			p.pos++
+		}
+	}
+}
+
+// readAtLeastList consumes AT_LEAST arguments up to and including the parenthesized alarm list,
+// e.g. `2, ALARM, (alarm-a, "alarm b")`.
+func (p *ruleParser) readAtLeastList() {
+	for p.pos < len(p.input) && p.input[p.pos] != '(' {
+		if p.input[p.pos] == ')' {
+			return
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.input) {
+		return
+	}
+
+	p.pos++
+	for p.pos < len(p.input) {
+		p.add(p.readArg())
+		p.skipSpaces()
+
+		if p.pos >= len(p.input) {
+			return
+		}
+		if p.input[p.pos] == ')' {
+			p.pos++
+			return
+		}
+		p.pos++
+	}
+}
+
+// readArg reads a single quoted or unquoted function argument, leaving the position at the
+// terminating ',' or ')'.
+func (p *ruleParser) readArg() string {
+	p.skipSpaces()
+	if p.pos < len(p.input) && p.input[p.pos] == '"' {
+		arg := p.readQuoted()
+		for p.pos < len(p.input) && p.input[p.pos] != ',' && p.input[p.pos] != ')' {
+			p.pos++
+		}
+		return arg
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && p.input[p.pos] != ',' && p.input[p.pos] != ')' {
+		p.pos++
+	}
+	return strings.TrimSpace(p.input[start:p.pos])
+}
+
+// readQuoted reads a double-quoted string starting at the current position, honoring backslash escapes.
+func (p *ruleParser) readQuoted() string {
+	p.pos++
+
+	var sb strings.Builder
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		p.pos++
+
+		switch c {
+		case '\\':
+			if p.pos < len(p.input) {
+				sb.WriteByte(p.input[p.pos])
+				p.pos++
+			}
+		case '"':
+			return sb.String()
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func (p *ruleParser) readIdent() string {
+	start := p.pos
+	for p.pos < len(p.input) && isIdentByte(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *ruleParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *ruleParser) add(ref string) {
+	name := alarmNameFromRef(ref)
+	if name == "" || p.seen[name] {
+		return
+	}
+	p.seen[name] = true
+	p.names = append(p.names, name)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
+
+// alarmNameFromRef returns the alarm name for a rule reference, which may be a name or an alarm ARN.
+func alarmNameFromRef(ref string) string {
+	if strings.HasPrefix(ref, "arn:") {
+		if _, name, ok := strings.Cut(ref, ":alarm:"); ok {
+			return name
+		}
+	}
+	return ref
+}
@@ -0,0 +1,62 @@
+package alarm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAlarmRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		want []string
+	}{
+		{
+			name: "single quoted alarm",
+			rule: `ALARM("cpu-high")`,
+			want: []string{"cpu-high"},
+		},
+		{
+			name: "unquoted names and boolean operators",
+			rule: `ALARM(cpu-high) AND NOT (OK(disk-full) OR INSUFFICIENT_DATA(mem-high))`,
+			want: []string{"cpu-high", "disk-full", "mem-high"},
+		},
+		{
+			name: "duplicates are reported once",
+			rule: `ALARM("a") OR (ALARM("b") AND OK("a"))`,
+			want: []string{"a", "b"},
+		},
+		{
+			name: "alarm ARN reduced to name",
+			rule: `ALARM("arn:aws:cloudwatch:us-east-1:123456789012:alarm:api-5xx")`,
+			want: []string{"api-5xx"},
+		},
+		{
+			name: "quoted name with spaces and parentheses",
+			rule: `ALARM("latency (p99) high") AND TRUE`,
+			want: []string{"latency (p99) high"},
+		},
+		{
+			name: "AT_LEAST list",
+			rule: `AT_LEAST(2, ALARM, ("a", b, "c")) AND ALARM(d)`,
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "AT_LEAST with percentage and negated state",
+			rule: `AT_LEAST(50%, NOT OK, (x, y))`,
+			want: []string{"x", "y"},
+		},
+		{
+			name: "constants only",
+			rule: `TRUE OR FALSE`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseAlarmRule(tt.rule))
+		})
+	}
+}
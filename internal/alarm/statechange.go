@@ -0,0 +1,211 @@
+package alarm
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+var (
+	// reasonOutOf matches "3 out of the last 5 datapoints" in a threshold crossing reason.
+	reasonOutOf = regexp.MustCompile(`\b(\d+) out of the last (\d+) datapoints?\b`)
+	// reasonSingle matches the single-period form "1 datapoint [...]".
+	reasonSingle = regexp.MustCompile(`\b(\d+) datapoints? \[`)
+	// reasonOperator matches the comparison in a threshold crossing reason. Longer operators come
+	// first so that "greater than or equal to" is not cut short at "greater than".
+	reasonOperator = regexp.MustCompile(
+		`\b(?:was|were) (?:not )?(greater than or equal to|greater than|less than or equal to|less than) the threshold\b`)
+)
+
+var reasonOperators = map[string]types.ComparisonOperator{
+	"greater than or equal to": types.ComparisonOperatorGreaterThanOrEqualToThreshold,
+	"greater than":             types.ComparisonOperatorGreaterThanThreshold,
+	"less than or equal to":    types.ComparisonOperatorLessThanOrEqualToThreshold,
+	"less than":                types.ComparisonOperatorLessThanThreshold,
+}
+
+// alarmFromStateChange rebuilds the alarm from a state change payload so that it doesn't have to
+// be described again. It reports false when the payload doesn't carry everything enrichment needs:
+// metric alarms need their metrics, and the comparison operator, M out of N and threshold that
+// CloudWatch only includes in the state reason. Anomaly detection alarms therefore always fall back
+// to DescribeAlarms. TreatMissingData is not part of the payload and is set to CloudWatch's default,
+// "missing".
+func alarmFromStateChange(sc *events.AlarmStateChange) (*types.MetricAlarm, *types.CompositeAlarm, bool) {
+	if sc == nil || sc.AlarmName == "" || sc.State.Value == "" {
+		return nil, nil, false
+	}
+
+	var updated *time.Time
+	if t, err := sc.State.Time(); err == nil {
+		updated = &t
+	}
+
+	if sc.Configuration.AlarmRule != "" {
+		return nil, &types.CompositeAlarm{
+			AlarmName:             aws.String(sc.AlarmName),
+			AlarmDescription:      optionalString(sc.Configuration.Description),
+			AlarmRule:             aws.String(sc.Configuration.AlarmRule),
+			StateValue:            sc.State.Value,
+			StateReason:           aws.String(sc.State.Reason),
+			StateUpdatedTimestamp: updated,
+		}, true
+	}
+
+	if len(sc.Configuration.Metrics) == 0 || sc.State.ReasonData == nil || sc.State.ReasonData.Threshold == nil {
+		return nil, nil, false
+	}
+
+	op := reasonOperator.FindStringSubmatch(sc.State.Reason)
+	if op == nil {
+		return nil, nil, false
+	}
+
+	m, n, ok := parseReasonDatapoints(sc.State.Reason)
+	if !ok {
+		return nil, nil, false
+	}
+
+	alarm := &types.MetricAlarm{
+		AlarmName:             aws.String(sc.AlarmName),
+		AlarmDescription:      optionalString(sc.Configuration.Description),
+		StateValue:            sc.State.Value,
+		StateReason:           aws.String(sc.State.Reason),
+		StateUpdatedTimestamp: updated,
+		ComparisonOperator:    reasonOperators[op[1]],
+		Threshold:             sc.State.ReasonData.Threshold,
+		EvaluationPeriods:     aws.Int32(n),
+		DatapointsToAlarm:     aws.Int32(m),
+		TreatMissingData:      aws.String(treatMissingDefault),
+	}
+
+	metrics := sc.Configuration.Metrics
+	if len(metrics) == 1 && metrics[0].MetricStat != nil {
+		stat := metrics[0].MetricStat
+		alarm.Namespace = aws.String(stat.Metric.Namespace)
+		alarm.MetricName = aws.String(stat.Metric.Name)
+		alarm.Dimensions = toDimensions(stat.Metric.Dimensions)
+		alarm.Period = aws.Int32(stat.Period)
+		if stat.Unit != "" {
+			alarm.Unit = types.StandardUnit(stat.Unit)
+		}
+		if slices.Contains(types.Statistic("").Values(), types.Statistic(stat.Stat)) {
+			alarm.Statistic = types.Statistic(stat.Stat)
+		} else {
+			alarm.ExtendedStatistic = aws.String(stat.Stat)
+		}
+		return alarm, nil, true
+	}
+
+	for _, metric := range metrics {
+		alarm.Metrics = append(alarm.Metrics, toMetricDataQuery(metric))
+	}
+
+	return alarm, nil, true
+}
+
+// applyStateChange sets the state of a described alarm to the one the state change reports, so that
+// an event delivered late or retried after the alarm changed state again is still enriched and
+// notified as the transition it reports. Without a state in the payload the described state is kept.
+func applyStateChange(alarm *types.MetricAlarm, composite *types.CompositeAlarm, sc *events.AlarmStateChange) {
+	if sc == nil || sc.State.Value == "" {
+		return
+	}
+
+	var updated *time.Time
+	if t, err := sc.State.Time(); err == nil {
+		updated = &t
+	}
+
+	switch {
+	case alarm != nil:
+		alarm.StateValue = sc.State.Value
+		alarm.StateReason = aws.String(sc.State.Reason)
+		if updated != nil {
+			alarm.StateUpdatedTimestamp = updated
+		}
+	case composite != nil:
+		composite.StateValue = sc.State.Value
+		composite.StateReason = aws.String(sc.State.Reason)
+		if updated != nil {
+			composite.StateUpdatedTimestamp = updated
+		}
+	}
+}
+
+// parseReasonDatapoints extracts DatapointsToAlarm (m) and EvaluationPeriods (n) from a state reason.
+func parseReasonDatapoints(reason string) (int32, int32, bool) {
+	if match := reasonOutOf.FindStringSubmatch(reason); match != nil {
+		m, errM := strconv.ParseInt(match[1], 10, 32)
+		n, errN := strconv.ParseInt(match[2], 10, 32)
+		if errM != nil || errN != nil || m <= 0 || n <= 0 {
+			return 0, 0, false
+		}
+		return int32(m), int32(n), true
+	}
+
+	if match := reasonSingle.FindStringSubmatch(reason); match != nil {
+		n, err := strconv.ParseInt(match[1], 10, 32)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		return int32(n), int32(n), true
+	}
+
+	return 0, 0, false
+}
+
+func toMetricDataQuery(metric events.AlarmMetric) types.MetricDataQuery {
+	query := types.MetricDataQuery{
+		Id:         aws.String(metric.ID),
+		Expression: optionalString(metric.Expression),
+		Label:      optionalString(metric.Label),
+		ReturnData: aws.Bool(metric.ReturnData),
+	}
+
+	if stat := metric.MetricStat; stat != nil {
+		query.MetricStat = &types.MetricStat{
+			Metric: &types.Metric{
+				Namespace:  aws.String(stat.Metric.Namespace),
+				MetricName: aws.String(stat.Metric.Name),
+				Dimensions: toDimensions(stat.Metric.Dimensions),
+			},
+			Period: aws.Int32(stat.Period),
+			Stat:   aws.String(stat.Stat),
+			Unit:   types.StandardUnit(stat.Unit),
+		}
+	}
+
+	return query
+}
+
+// toDimensions converts a dimension map to dimensions sorted by name.
+func toDimensions(dims map[string]string) []types.Dimension {
+	names := make([]string, 0, len(dims))
+	for name := range dims {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	dimensions := make([]types.Dimension, 0, len(names))
+	for _, name := range names {
+		dimensions = append(dimensions, types.Dimension{
+			Name:  aws.String(name),
+			Value: aws.String(dims[name]),
+		})
+	}
+
+	return dimensions
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
@@ -0,0 +1,165 @@
+// Package awsclient provides AWS service clients scoped to the account and region an alarm lives in.
+package awsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+)
+
+// AccountIDPlaceholder is replaced with the target account ID in role ARN templates.
+const AccountIDPlaceholder = "{accountID}"
+
+// roleSessionName identifies the enricher's sessions in the target account's CloudTrail.
+const roleSessionName = "cloudwatch-alarm-enricher"
+
+// ErrInvalidAccountID indicates an account ID that is not a 12-digit AWS account ID.
+var ErrInvalidAccountID = errors.New("invalid account ID")
+
+// Pool hands out AWS configs per account and region. The home account uses the base credentials;
+// any other account uses credentials from assuming the role built from the role ARN template.
+// Configs are cached for the lifetime of the Pool, so warm invocations reuse credentials
+// until they expire. Credentials are shared by all regions of an account.
+type Pool struct {
+	base            aws.Config
+	sts             stscreds.AssumeRoleAPIClient
+	homeAccountID   string
+	roleARNTemplate string
+
+	mu          sync.Mutex
+	configs     map[string]aws.Config
+	credentials map[string]aws.CredentialsProvider
+}
+
+// NewPool creates a Pool. An empty roleARNTemplate disables cross-account access: every account
+// then gets the base config, as if it were the home account.
+func NewPool(base aws.Config, sts stscreds.AssumeRoleAPIClient, homeAccountID, roleARNTemplate string) *Pool {
+	return &Pool{
+		base:            base,
+		sts:             sts,
+		homeAccountID:   homeAccountID,
+		roleARNTemplate: roleARNTemplate,
+		configs:         make(map[string]aws.Config),
+		credentials:     make(map[string]aws.CredentialsProvider),
+	}
+}
+
+// Config returns the AWS config for accessing the given account in the given region.
+// An empty region means the base config's region.
+func (p *Pool) Config(_ context.Context, accountID, region string) (aws.Config, error) {
+	crossAccount := p.roleARNTemplate != "" && accountID != "" && accountID != p.homeAccountID
+	if !crossAccount && (region == "" || region == p.base.Region) {
+		return p.base, nil
+	}
+
+	if crossAccount && !isAccountID(accountID) {
+		return aws.Config{}, fmt.Errorf("%w: %q", ErrInvalidAccountID, accountID)
+	}
+	if !crossAccount {
+		accountID = p.homeAccountID
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := clientKey(accountID, region)
+	if cfg, ok := p.configs[key]; ok {
+		return cfg, nil
+	}
+
+	cfg := p.base.Copy()
+	if region != "" {
+		cfg.Region = region
+	}
+	if crossAccount {
+		cfg.Credentials = p.assumeRoleCredentials(accountID)
+	}
+
+	p.configs[key] = cfg
+
+	return cfg, nil
+}
+
+// assumeRoleCredentials returns the cached credentials for the role in the given account.
+// The caller must hold p.mu.
+func (p *Pool) assumeRoleCredentials(accountID string) aws.CredentialsProvider {
+	if creds, ok := p.credentials[accountID]; ok {
+		return creds
+	}
+
+	roleARN := RoleARN(p.roleARNTemplate, accountID)
+	creds := aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(p.sts, roleARN,
+		func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = roleSessionName
+		}))
+
+	p.credentials[accountID] = creds
+
+	return creds
+}
+
+// RoleARN builds the ARN of the role to assume in an account from a role ARN template.
+func RoleARN(template, accountID string) string {
+	return strings.ReplaceAll(template, AccountIDPlaceholder, accountID)
+}
+
+func clientKey(accountID, region string) string {
+	return accountID + "/" + region
+}
+
+func isAccountID(s string) bool {
+	if len(s) != 12 {
+		return false
+	}
+	for i := range len(s) {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Clients caches service clients per account and region, built from the configs of a Pool.
+type Clients[T any] struct {
+	pool      *Pool
+	newClient func(aws.Config) T
+
+	mu      sync.Mutex
+	clients map[string]T
+}
+
+// NewClients creates a per-account, per-region client cache that builds clients with newClient.
+func NewClients[T any](pool *Pool, newClient func(aws.Config) T) *Clients[T] {
+	return &Clients[T]{
+		pool:      pool,
+		newClient: newClient,
+		clients:   make(map[string]T),
+	}
+}
+
+// Client returns the client for the given account and region, creating it on first use.
+func (c *Clients[T]) Client(ctx context.Context, accountID, region string) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := clientKey(accountID, region)
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+
+	cfg, err := c.pool.Config(ctx, accountID, region)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	client := c.newClient(cfg)
+	c.clients[key] = client
+
+	return client, nil
+}
@@ -0,0 +1,92 @@
+package awsclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const roleARNTemplate = "arn:aws:iam::{accountID}:role/AlarmEnricher"
+
+func TestRoleARN(t *testing.T) {
+	assert.Equal(t, "arn:aws:iam::222222222222:role/AlarmEnricher", RoleARN(roleARNTemplate, "222222222222"))
+}
+
+func TestPoolConfig(t *testing.T) {
+	base := aws.Config{Region: "eu-west-1", Credentials: aws.AnonymousCredentials{}}
+	pool := NewPool(base, sts.New(sts.Options{}), "111111111111", roleARNTemplate)
+	ctx := context.Background()
+
+	home, err := pool.Config(ctx, "111111111111", "")
+	require.NoError(t, err)
+	assert.Equal(t, base.Credentials, home.Credentials)
+
+	member, err := pool.Config(ctx, "222222222222", "")
+	require.NoError(t, err)
+	assert.NotEqual(t, base.Credentials, member.Credentials)
+	assert.Equal(t, "eu-west-1", member.Region)
+
+	again, err := pool.Config(ctx, "222222222222", "")
+	require.NoError(t, err)
+	assert.Same(t, member.Credentials, again.Credentials)
+
+	_, err = pool.Config(ctx, "not-an-account", "")
+	require.ErrorIs(t, err, ErrInvalidAccountID)
+}
+
+func TestPoolConfig_CrossAccountDisabled(t *testing.T) {
+	base := aws.Config{Credentials: aws.AnonymousCredentials{}}
+	pool := NewPool(base, sts.New(sts.Options{}), "", "")
+
+	cfg, err := pool.Config(context.Background(), "222222222222", "")
+	require.NoError(t, err)
+	assert.Equal(t, base.Credentials, cfg.Credentials)
+}
+
+func TestPoolConfig_Region(t *testing.T) {
+	base := aws.Config{Region: "eu-west-1", Credentials: aws.AnonymousCredentials{}}
+	pool := NewPool(base, sts.New(sts.Options{}), "111111111111", roleARNTemplate)
+	ctx := context.Background()
+
+	home, err := pool.Config(ctx, "111111111111", "us-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-1", home.Region)
+	assert.Equal(t, base.Credentials, home.Credentials)
+
+	west, err := pool.Config(ctx, "222222222222", "eu-west-1")
+	require.NoError(t, err)
+	east, err := pool.Config(ctx, "222222222222", "us-east-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "eu-west-1", west.Region)
+	assert.Equal(t, "us-east-1", east.Region)
+	assert.Same(t, west.Credentials, east.Credentials)
+}
+
+func TestClients(t *testing.T) {
+	pool := NewPool(aws.Config{}, sts.New(sts.Options{}), "111111111111", roleARNTemplate)
+
+	built := 0
+	clients := NewClients(pool, func(cfg aws.Config) *aws.Config {
+		built++
+		return &cfg
+	})
+
+	first, err := clients.Client(context.Background(), "222222222222", "us-east-1")
+	require.NoError(t, err)
+	second, err := clients.Client(context.Background(), "222222222222", "us-east-1")
+	require.NoError(t, err)
+
+	assert.Same(t, first, second)
+	assert.Equal(t, "us-east-1", first.Region)
+	assert.Equal(t, 1, built)
+
+	other, err := clients.Client(context.Background(), "222222222222", "eu-west-1")
+	require.NoError(t, err)
+	assert.NotSame(t, first, other)
+	assert.Equal(t, 2, built)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -75,6 +76,17 @@ func ParseNonEmptyString(s string) (string, error) {
 	return s, nil
 }
 
+// ParseStringList parses a comma-separated list, trimming whitespace and dropping empty items.
+func ParseStringList(s string) ([]string, error) {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
 // ParseInt parses a string as a base-10 int64.
 func ParseInt(s string) (int64, error) {
 	return strconv.ParseInt(s, 10, 64)
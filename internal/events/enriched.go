@@ -4,6 +4,7 @@ package events
 import (
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
 )
 
@@ -12,13 +13,274 @@ type ViolatingMetric struct {
 	Value      float64           `json:"value"`
 	Dimensions map[string]string `json:"dimensions"`
 	Timestamp  time.Time         `json:"timestamp"`
+	// Band is the expected range the value fell outside of; set for anomaly detection alarms only.
+	Band *Band `json:"band,omitempty"`
+	// BreachingDatapoints is how many of the EvaluatedDatapoints in the evaluation window breached.
+	// Both are 0 for a resource without data in the window that kept the state of its last
+	// datapoint, as alarms ignoring missing data do.
+	BreachingDatapoints int `json:"breachingDatapoints"`
+	EvaluatedDatapoints int `json:"evaluatedDatapoints"`
+	// Distance is how far Value is beyond the threshold, or beyond the band for anomaly detection
+	// alarms. RelativeDistance is Distance as a fraction of the threshold or of the band width.
+	// Violating metrics are ordered by RelativeDistance, most severe first.
+	Distance         float64 `json:"distance"`
+	RelativeDistance float64 `json:"relativeDistance"`
+	// ResourceARN is the resource the metric describes, when its dimensions identify one.
+	ResourceARN string `json:"resourceARN,omitempty"`
+	// Tags are selected tags of the resource, such as Name, Team, Owner and Environment.
+	Tags map[string]string `json:"tags,omitempty"`
+	// ConsoleURL links to the metric in the CloudWatch console over the evaluation window.
+	ConsoleURL string `json:"consoleURL,omitempty"`
+	// History is the metric's series over the evaluation window and the lookback before it,
+	// oldest first; set only when history is enabled.
+	History []Datapoint `json:"history,omitempty"`
+	// Status tells whether the resource started violating with this event or was already violating
+	// at a previous one, and FirstSeen when it was first seen violating; set only when violation
+	// state is tracked.
+	Status    ViolationStatus `json:"status,omitempty"`
+	FirstSeen time.Time       `json:"firstSeen,omitzero"`
+}
+
+// ViolationStatus classifies a resource against the violations recorded for its alarm before.
+type ViolationStatus string
+
+const (
+	// ViolationNew marks a resource that was not violating at the previous event of its alarm.
+	ViolationNew ViolationStatus = "new"
+	// ViolationOngoing marks a resource that was already violating at the previous event.
+	ViolationOngoing ViolationStatus = "ongoing"
+	// ViolationResolved marks a resource that was violating at the previous event and no longer is.
+	ViolationResolved ViolationStatus = "resolved"
+)
+
+// ResolvedResource is a resource that was violating at a previous event of its alarm and no
+// longer is.
+type ResolvedResource struct {
+	Dimensions map[string]string `json:"dimensions"`
+	// FirstSeen and LastSeen are the times of the first and last events it was violating at.
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Datapoint is a single value of a metric series.
+type Datapoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Band is the range of expected values computed by a CloudWatch anomaly detection model.
+type Band struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// TimeWindow is a time range, inclusive of Start and exclusive of End.
+type TimeWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ImpactSummary counts the resources an alarm covers by the outcome of their evaluation, so that
+// notifications can tell how widespread a breach is.
+type ImpactSummary struct {
+	// Candidates is the number of resources evaluated; the other counts add up to it.
+	Candidates int `json:"candidates"`
+	Violating  int `json:"violating"`
+	Healthy    int `json:"healthy"`
+	// NoData counts resources without datapoints in the evaluation window.
+	NoData int `json:"noData"`
+	// Incomplete counts resources whose datapoints CloudWatch didn't return in full.
+	Incomplete int `json:"incomplete"`
+	// Failed counts resources whose datapoints couldn't be fetched at all.
+	Failed int `json:"failed,omitempty"`
+	// ViolatingRatio is Violating as a fraction of Candidates.
+	ViolatingRatio float64 `json:"violatingRatio"`
+}
+
+// EnrichmentErrorReason tells why some resources of an alarm could not be evaluated.
+type EnrichmentErrorReason string
+
+const (
+	// EnrichmentBatchFailed marks a GetMetricData batch whose requests failed.
+	EnrichmentBatchFailed EnrichmentErrorReason = "batchFailed"
+	// EnrichmentDataIncomplete marks metrics whose datapoints CloudWatch didn't return in full.
+	EnrichmentDataIncomplete EnrichmentErrorReason = "dataIncomplete"
+	// EnrichmentCandidatesSampled marks resources left out because the alarm covers more of them
+	// than the candidate cap.
+	EnrichmentCandidatesSampled EnrichmentErrorReason = "candidatesSampled"
+	// EnrichmentAlarmFailed marks a child alarm of a composite alarm that could not be enriched at
+	// all; none of its resources were evaluated.
+	EnrichmentAlarmFailed EnrichmentErrorReason = "alarmFailed"
+)
+
+// EnrichmentError records resources of an alarm that could not be evaluated, so that the
+// violating metrics reported were found among the other resources only.
+type EnrichmentError struct {
+	Reason EnrichmentErrorReason `json:"reason"`
+	// Batch is the index of the GetMetricData batch the resources were queried in; 0 for resources
+	// never queried.
+	Batch int `json:"batch"`
+	// Metrics counts the resources affected.
+	Metrics int `json:"metrics"`
+	// Dimensions identifies the resources whose data was incomplete.
+	Dimensions []map[string]string `json:"dimensions,omitempty"`
+	// Message is the error that failed the batch, or explains why resources were left out.
+	Message string `json:"message,omitempty"`
+}
+
+// Recovery describes an incident that ended with the alarm returning from ALARM to OK state.
+type Recovery struct {
+	// AlarmedAt is when the alarm entered ALARM state and RecoveredAt when it returned to OK.
+	AlarmedAt   time.Time `json:"alarmedAt"`
+	RecoveredAt time.Time `json:"recoveredAt"`
+	// DurationSeconds is how long the alarm was in ALARM state.
+	DurationSeconds int64 `json:"durationSeconds"`
+	// AlarmWindow is the evaluation window that raised the alarm; set for metric alarms.
+	AlarmWindow *TimeWindow `json:"alarmWindow,omitempty"`
+	// ResolvedMetrics are the metrics that violated the threshold when the alarm was raised and are
+	// within it now, most severe at the time of the alarm first. Value and Timestamp are those of
+	// their latest datapoint.
+	ResolvedMetrics []ViolatingMetric `json:"resolvedMetrics,omitempty"`
+	// OmittedResolvedMetrics counts the resolved metrics left out of ResolvedMetrics.
+	OmittedResolvedMetrics int `json:"omittedResolvedMetrics,omitempty"`
+	// StillViolating counts the metrics that violated the threshold when the alarm was raised and
+	// still do, although the alarm as a whole recovered.
+	StillViolating int `json:"stillViolating,omitempty"`
+}
+
+// Duration returns how long the alarm was in ALARM state.
+func (r *Recovery) Duration() time.Duration {
+	return time.Duration(r.DurationSeconds) * time.Second
+}
+
+// ChildAlarm represents an alarm referenced by a composite alarm rule.
+// Metric alarms carry their own violating metrics; composite alarms carry their own children.
+type ChildAlarm struct {
+	Alarm            *types.MetricAlarm    `json:"alarm,omitempty"`
+	CompositeAlarm   *types.CompositeAlarm `json:"compositeAlarm,omitempty"`
+	AlarmURL         string                `json:"alarmURL,omitempty"`
+	EvaluationWindow *TimeWindow           `json:"evaluationWindow,omitempty"`
+	ViolatingMetrics []ViolatingMetric     `json:"violatingMetrics,omitempty"`
+	// OmittedViolatingMetrics counts the less severe violating metrics left out of ViolatingMetrics.
+	OmittedViolatingMetrics int                `json:"omittedViolatingMetrics,omitempty"`
+	ResolvedResources       []ResolvedResource `json:"resolvedResources,omitempty"`
+	Summary                 *ImpactSummary     `json:"summary,omitempty"`
+	EnrichmentErrors        []EnrichmentError  `json:"enrichmentErrors,omitempty"`
+	ChildAlarms             []ChildAlarm       `json:"childAlarms,omitempty"`
+}
+
+// EnrichmentFailed reports whether the child alarm could not be enriched at all.
+func (c ChildAlarm) EnrichmentFailed() bool {
+	for _, err := range c.EnrichmentErrors {
+		if err.Reason == EnrichmentAlarmFailed {
+			return true
+		}
+	}
+	return false
 }
 
 // EnrichedEvent represents a CloudWatch alarm enriched with violating metric details.
 // It includes the original alarm state plus specific resources currently violating thresholds.
+// Exactly one of Alarm and CompositeAlarm is set.
 type EnrichedEvent struct {
-	AccountID        string             `json:"accountID"`
-	Timestamp        time.Time          `json:"timestamp"`
-	Alarm            *types.MetricAlarm `json:"alarm"`
-	ViolatingMetrics []ViolatingMetric  `json:"violatingMetrics"`
+	AccountID      string                `json:"accountID"`
+	Region         string                `json:"region,omitempty"`
+	Timestamp      time.Time             `json:"timestamp"`
+	Alarm          *types.MetricAlarm    `json:"alarm"`
+	CompositeAlarm *types.CompositeAlarm `json:"compositeAlarm,omitempty"`
+	// AlarmURL links to the alarm in the CloudWatch console.
+	AlarmURL string `json:"alarmURL,omitempty"`
+	// GraphURL links to a snapshot graph of the alarm metric and its top violating resources.
+	GraphURL string `json:"graphURL,omitempty"`
+	// StateChange is the state change that triggered enrichment, including the previous state.
+	StateChange *AlarmStateChange `json:"stateChange,omitempty"`
+	// EvaluationWindow is the window the violating metrics were evaluated over; set for metric alarms
+	// in ALARM or INSUFFICIENT_DATA state.
+	EvaluationWindow *TimeWindow       `json:"evaluationWindow,omitempty"`
+	ViolatingMetrics []ViolatingMetric `json:"violatingMetrics"`
+	// OmittedViolatingMetrics counts the less severe violating metrics left out of ViolatingMetrics.
+	OmittedViolatingMetrics int `json:"omittedViolatingMetrics,omitempty"`
+	// SilentMetrics are the metrics of an alarm in INSUFFICIENT_DATA state that stopped reporting:
+	// they have datapoints in the lookback before the evaluation window but none in it. Value and
+	// Timestamp are those of their last datapoint; the longest silent come first.
+	SilentMetrics []ViolatingMetric `json:"silentMetrics,omitempty"`
+	// OmittedSilentMetrics counts the silent metrics left out of SilentMetrics.
+	OmittedSilentMetrics int `json:"omittedSilentMetrics,omitempty"`
+	// ResolvedResources are the resources that were violating at the previous event of the alarm
+	// and no longer are; set only when violation state is tracked.
+	ResolvedResources []ResolvedResource `json:"resolvedResources,omitempty"`
+	// Recovery is set when the alarm returned from ALARM to OK state.
+	Recovery *Recovery `json:"recovery,omitempty"`
+	// Summary counts the resources the alarm covers by outcome; set for metric alarms in ALARM or
+	// INSUFFICIENT_DATA state and for recovered metric alarms.
+	Summary *ImpactSummary `json:"summary,omitempty"`
+	// EnrichmentErrors lists the resources of a metric alarm that could not be evaluated.
+	EnrichmentErrors []EnrichmentError `json:"enrichmentErrors,omitempty"`
+	// Partial is set when some resources of the alarm, or of any of its child alarms, could not be
+	// evaluated, so that violating metrics may be missing.
+	Partial bool `json:"partial,omitempty"`
+	// EnrichmentFailure is the error that failed the enrichment of a fallback event, one built from
+	// the state change payload alone so that the alarm is notified all the same.
+	EnrichmentFailure string       `json:"enrichmentFailure,omitempty"`
+	ChildAlarms       []ChildAlarm `json:"childAlarms,omitempty"`
+}
+
+// AlarmName returns the name of the enriched alarm, metric or composite.
+func (e *EnrichedEvent) AlarmName() string {
+	if e.CompositeAlarm != nil {
+		return aws.ToString(e.CompositeAlarm.AlarmName)
+	}
+	if e.Alarm != nil {
+		return aws.ToString(e.Alarm.AlarmName)
+	}
+	return ""
+}
+
+// EnrichmentFailed reports whether the event is a fallback for an alarm whose enrichment failed.
+func (e *EnrichedEvent) EnrichmentFailed() bool {
+	return e.EnrichmentFailure != ""
+}
+
+// IsRecovery reports whether the event describes an alarm that returned from ALARM to OK state.
+func (e *EnrichedEvent) IsRecovery() bool {
+	return e.Recovery != nil
+}
+
+// StateValue returns the state of the enriched alarm, metric or composite: the one its state change
+// reports, or the one it was described in when there is none.
+func (e *EnrichedEvent) StateValue() types.StateValue {
+	if e.StateChange != nil && e.StateChange.State.Value != "" {
+		return e.StateChange.State.Value
+	}
+	if e.CompositeAlarm != nil {
+		return e.CompositeAlarm.StateValue
+	}
+	if e.Alarm != nil {
+		return e.Alarm.StateValue
+	}
+	return ""
+}
+
+// StateReason returns the state reason of the enriched alarm, metric or composite.
+func (e *EnrichedEvent) StateReason() string {
+	if e.CompositeAlarm != nil {
+		return aws.ToString(e.CompositeAlarm.StateReason)
+	}
+	if e.Alarm != nil {
+		return aws.ToString(e.Alarm.StateReason)
+	}
+	return ""
+}
+
+// IsBandComparison reports whether the operator compares against an anomaly detection band
+// rather than a static threshold.
+func IsBandComparison(op types.ComparisonOperator) bool {
+	switch op {
+	case types.ComparisonOperatorLessThanLowerOrGreaterThanUpperThreshold,
+		types.ComparisonOperatorGreaterThanUpperThreshold,
+		types.ComparisonOperatorLessThanLowerThreshold:
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// StateTimestampLayout parses the state timestamps of alarm state change events,
+// e.g. "2024-01-02T15:04:05.123+0000". Fractional seconds are accepted implicitly.
+const StateTimestampLayout = "2006-01-02T15:04:05-0700"
+
+// AlarmStateChange is the detail of a "CloudWatch Alarm State Change" event.
+type AlarmStateChange struct {
+	AlarmName     string             `json:"alarmName"`
+	State         AlarmState         `json:"state"`
+	PreviousState AlarmState         `json:"previousState"`
+	Configuration AlarmConfiguration `json:"configuration"`
+}
+
+// AlarmState is the state of an alarm before or after a state change.
+type AlarmState struct {
+	Value      types.StateValue `json:"value"`
+	Reason     string           `json:"reason,omitempty"`
+	ReasonData *ReasonData      `json:"reasonData,omitempty"`
+	Timestamp  string           `json:"timestamp,omitempty"`
+}
+
+// Time parses the time at which the alarm entered the state.
+func (s AlarmState) Time() (time.Time, error) {
+	return time.Parse(StateTimestampLayout, s.Timestamp)
+}
+
+// ReasonData is the machine-readable reason for a metric alarm state. CloudWatch delivers it
+// as a JSON-encoded string; composite alarms carry fields that are not modelled here.
+type ReasonData struct {
+	Version             string               `json:"version,omitempty"`
+	QueryDate           string               `json:"queryDate,omitempty"`
+	StartDate           string               `json:"startDate,omitempty"`
+	Statistic           string               `json:"statistic,omitempty"`
+	Period              int32                `json:"period,omitempty"`
+	RecentDatapoints    []float64            `json:"recentDatapoints,omitempty"`
+	Threshold           *float64             `json:"threshold,omitempty"`
+	EvaluatedDatapoints []EvaluatedDatapoint `json:"evaluatedDatapoints,omitempty"`
+}
+
+// UnmarshalJSON decodes reason data from either its JSON-encoded string form or a plain object.
+func (r *ReasonData) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err == nil {
+		if encoded == "" {
+			return nil
+		}
+		data = []byte(encoded)
+	}
+
+	type reasonData ReasonData
+	return json.Unmarshal(data, (*reasonData)(r))
+}
+
+// EvaluatedDatapoint is a datapoint CloudWatch considered when it last evaluated the alarm.
+type EvaluatedDatapoint struct {
+	Timestamp   string   `json:"timestamp"`
+	SampleCount *float64 `json:"sampleCount,omitempty"`
+	Value       *float64 `json:"value,omitempty"`
+}
+
+// AlarmConfiguration is the alarm configuration included in a state change event.
+// Metric alarms carry their metrics; composite alarms carry their rule.
+type AlarmConfiguration struct {
+	Description string        `json:"description,omitempty"`
+	AlarmRule   string        `json:"alarmRule,omitempty"`
+	Metrics     []AlarmMetric `json:"metrics,omitempty"`
+}
+
+// AlarmMetric is a metric or expression an alarm is built on.
+type AlarmMetric struct {
+	ID         string           `json:"id"`
+	MetricStat *AlarmMetricStat `json:"metricStat,omitempty"`
+	Expression string           `json:"expression,omitempty"`
+	Label      string           `json:"label,omitempty"`
+	ReturnData bool             `json:"returnData"`
+}
+
+// AlarmMetricStat is a single metric with its statistic and period.
+type AlarmMetricStat struct {
+	Metric struct {
+		Namespace  string            `json:"namespace"`
+		Name       string            `json:"name"`
+		Dimensions map[string]string `json:"dimensions,omitempty"`
+	} `json:"metric"`
+	Period int32  `json:"period"`
+	Stat   string `json:"stat"`
+	Unit   string `json:"unit,omitempty"`
+}
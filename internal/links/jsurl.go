@@ -0,0 +1,99 @@
+package links
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// field is a key/value pair of an object; objects keep their field order.
+type field struct {
+	key   string
+	value any
+}
+
+// object is an ordered set of fields.
+type object []field
+
+// jsurl serializes a value in the JSURL notation the CloudWatch console uses in its URLs:
+// strings are prefixed with ', objects and arrays are parenthesized, and every value is
+// introduced by ~. Supported values are strings, bools, ints, floats, []any and object.
+func jsurl(v any) string {
+	var b strings.Builder
+	writeJSURL(&b, v)
+	return b.String()
+}
+
+func writeJSURL(b *strings.Builder, v any) {
+	switch v := v.(type) {
+	case string:
+		b.WriteString("~'")
+		b.WriteString(encodeJSURL(v))
+	case bool:
+		b.WriteString("~")
+		b.WriteString(strconv.FormatBool(v))
+	case int:
+		b.WriteString("~")
+		b.WriteString(strconv.Itoa(v))
+	case float64:
+		b.WriteString("~")
+		b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case []any:
+		b.WriteString("~(")
+		if len(v) == 0 {
+			b.WriteString("~")
+		}
+		for _, item := range v {
+			writeJSURL(b, item)
+		}
+		b.WriteString(")")
+	case object:
+		b.WriteString("~(")
+		for i, f := range v {
+			if i > 0 {
+				b.WriteString("~")
+			}
+			b.WriteString(encodeJSURL(f.key))
+			writeJSURL(b, f.value)
+		}
+		b.WriteString(")")
+	default:
+		panic(fmt.Sprintf("links: unsupported JSURL value %T", v))
+	}
+}
+
+// encodeJSURL escapes every character other than letters, digits, '_', '-' and '.':
+// '$' becomes '!', other characters become *XX or **XXXX hex escapes.
+func encodeJSURL(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			b.WriteRune(r)
+		case r == '$':
+			b.WriteByte('!')
+		case r < 0x100:
+			fmt.Fprintf(&b, "*%02x", r)
+		default:
+			// Characters outside the BMP are written as UTF-16 surrogate pairs, as JavaScript does.
+			if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+				fmt.Fprintf(&b, "**%04x**%04x", r1, r2)
+			} else {
+				fmt.Fprintf(&b, "**%04x", r)
+			}
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,197 @@
+// Package links builds AWS console deep links for enriched alarms.
+package links
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// Add sets the console links of an enriched event: the alarm link of the event and of every
+// child alarm, and a metrics link for every violating, silent and resolved metric. defaultRegion is used for events
+// that don't record the region the alarm lives in.
+func Add(event *events.EnrichedEvent, defaultRegion string) {
+	region := event.Region
+	if region == "" {
+		region = defaultRegion
+	}
+
+	event.AlarmURL = AlarmURL(region, event.AlarmName())
+	addMetricURLs(region, event.Alarm, event.EvaluationWindow, event.ViolatingMetrics)
+	addSilentURLs(region, event.Alarm, event.EvaluationWindow, event.SilentMetrics)
+	addChildURLs(region, event.ChildAlarms)
+
+	if r := event.Recovery; r != nil && r.AlarmWindow != nil && event.EvaluationWindow != nil {
+		// Graph resolved metrics over the whole incident.
+		incident := &events.TimeWindow{Start: r.AlarmWindow.Start, End: event.EvaluationWindow.End}
+		addMetricURLs(region, event.Alarm, incident, r.ResolvedMetrics)
+	}
+}
+
+func addChildURLs(region string, children []events.ChildAlarm) {
+	for i := range children {
+		child := &children[i]
+
+		if child.CompositeAlarm != nil {
+			child.AlarmURL = AlarmURL(region, aws.ToString(child.CompositeAlarm.AlarmName))
+			addChildURLs(region, child.ChildAlarms)
+			continue
+		}
+
+		if child.Alarm != nil {
+			child.AlarmURL = AlarmURL(region, aws.ToString(child.Alarm.AlarmName))
+			addMetricURLs(region, child.Alarm, child.EvaluationWindow, child.ViolatingMetrics)
+		}
+	}
+}
+
+func addMetricURLs(region string, alarm *types.MetricAlarm, window *events.TimeWindow, metrics []events.ViolatingMetric) {
+	if alarm == nil {
+		return
+	}
+
+	for i := range metrics {
+		metrics[i].ConsoleURL = MetricURL(region, alarm, metrics[i], window)
+	}
+}
+
+// addSilentURLs links metrics that stopped reporting to their graph from their last datapoint on,
+// so that the graph shows where the data ends.
+func addSilentURLs(region string, alarm *types.MetricAlarm, window *events.TimeWindow, metrics []events.ViolatingMetric) {
+	if alarm == nil || window == nil {
+		return
+	}
+
+	for i := range metrics {
+		w := *window
+		if metrics[i].Timestamp.Before(w.Start) {
+			w.Start = metrics[i].Timestamp
+		}
+		metrics[i].ConsoleURL = MetricURL(region, alarm, metrics[i], &w)
+	}
+}
+
+// AlarmURL returns the CloudWatch console link to an alarm.
+func AlarmURL(region, alarmName string) string {
+	return consoleURL(region) + "#alarmsV2:alarm/" + url.PathEscape(alarmName)
+}
+
+// MetricURL returns the CloudWatch metrics console link graphing a violating metric the way the
+// alarm watches it: same metric or expression, statistic and period, over the evaluation window.
+func MetricURL(region string, alarm *types.MetricAlarm, vm events.ViolatingMetric, window *events.TimeWindow) string {
+	graph := object{
+		{"view", "timeSeries"},
+		{"stacked", false},
+		{"region", region},
+		{"metrics", graphMetrics(alarm, vm)},
+	}
+
+	if alarm.MetricName != nil {
+		stat := string(alarm.Statistic)
+		if alarm.ExtendedStatistic != nil {
+			stat = aws.ToString(alarm.ExtendedStatistic)
+		}
+		graph = append(graph, field{"stat", stat})
+	}
+	if period := aws.ToInt32(alarm.Period); period > 0 {
+		graph = append(graph, field{"period", int(period)})
+	}
+	if window != nil {
+		graph = append(graph,
+			field{"start", window.Start.UTC().Format(time.RFC3339)},
+			field{"end", window.End.UTC().Format(time.RFC3339)})
+	}
+
+	return consoleURL(region) + "#metricsV2:graph=" + jsurl(graph)
+}
+
+// graphMetrics returns the metrics array of a console graph. Single-metric alarms graph the
+// violating metric itself; metric math alarms graph their expressions over legs narrowed to the
+// violating resource.
+func graphMetrics(alarm *types.MetricAlarm, vm events.ViolatingMetric) []any {
+	if alarm.MetricName != nil {
+		return []any{metricEntry(aws.ToString(alarm.Namespace), aws.ToString(alarm.MetricName), vm.Dimensions, nil)}
+	}
+
+	var metrics []any
+	for _, q := range alarm.Metrics {
+		options := object{{"id", aws.ToString(q.Id)}}
+		if !aws.ToBool(q.ReturnData) {
+			options = append(options, field{"visible", false})
+		}
+
+		if q.MetricStat != nil && q.MetricStat.Metric != nil {
+			m := q.MetricStat.Metric
+
+			dims := dimensionMap(m.Dimensions)
+			if covers(vm.Dimensions, dims) {
+				dims = vm.Dimensions
+			}
+
+			options = append(options, field{"stat", aws.ToString(q.MetricStat.Stat)})
+			if period := aws.ToInt32(q.MetricStat.Period); period > 0 {
+				options = append(options, field{"period", int(period)})
+			}
+
+			metrics = append(metrics, metricEntry(aws.ToString(m.Namespace), aws.ToString(m.MetricName), dims, options))
+			continue
+		}
+
+		options = append(object{{"expression", aws.ToString(q.Expression)}}, options...)
+		if q.Label != nil {
+			options = append(options, field{"label", aws.ToString(q.Label)})
+		}
+		metrics = append(metrics, []any{options})
+	}
+
+	return metrics
+}
+
+// metricEntry builds a console metric entry: namespace, metric name, dimension name/value pairs
+// sorted by name, and optional rendering options.
+func metricEntry(namespace, metricName string, dims map[string]string, options object) []any {
+	entry := []any{namespace, metricName}
+	for _, name := range sortedKeys(dims) {
+		entry = append(entry, name, dims[name])
+	}
+	if len(options) > 0 {
+		entry = append(entry, options)
+	}
+	return entry
+}
+
+// covers reports whether every dimension of want is present with the same value in have.
+func covers(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func dimensionMap(dimensions []types.Dimension) map[string]string {
+	dims := make(map[string]string, len(dimensions))
+	for _, d := range dimensions {
+		dims[aws.ToString(d.Name)] = aws.ToString(d.Value)
+	}
+	return dims
+}
+
+// consoleURL returns the CloudWatch console home of a region, honoring partition-specific domains.
+func consoleURL(region string) string {
+	domain := "console.aws.amazon.com"
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		domain = "console.amazonaws.cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		domain = "console.amazonaws-us-gov.com"
+	}
+
+	return "https://" + region + "." + domain + "/cloudwatch/home?region=" + region
+}
@@ -0,0 +1,107 @@
+package links
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+func TestJSURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{name: "plain string", value: "CPUUtilization", want: "~'CPUUtilization"},
+		{name: "escaped string", value: "AWS/EC2 $x", want: "~'AWS*2fEC2*20!x"},
+		{name: "non-latin string", value: "é€", want: "~'*e9**20ac"},
+		{name: "number", value: 300, want: "~300"},
+		{name: "bool", value: false, want: "~false"},
+		{name: "empty array", value: []any{}, want: "~(~)"},
+		{name: "array", value: []any{"a", 1}, want: "~(~'a~1)"},
+		{name: "object", value: object{{"view", "timeSeries"}, {"period", 60}}, want: "~(view~'timeSeries~period~60)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, jsurl(tt.value))
+		})
+	}
+}
+
+func TestAlarmURL(t *testing.T) {
+	assert.Equal(t,
+		"https://eu-west-1.console.aws.amazon.com/cloudwatch/home?region=eu-west-1#alarmsV2:alarm/cpu%20high",
+		AlarmURL("eu-west-1", "cpu high"))
+	assert.Equal(t,
+		"https://cn-north-1.console.amazonaws.cn/cloudwatch/home?region=cn-north-1#alarmsV2:alarm/cpu",
+		AlarmURL("cn-north-1", "cpu"))
+}
+
+func TestMetricURL(t *testing.T) {
+	alarm := &types.MetricAlarm{
+		AlarmName:  aws.String("cpu-high"),
+		Namespace:  aws.String("AWS/EC2"),
+		MetricName: aws.String("CPUUtilization"),
+		Statistic:  types.StatisticAverage,
+		Period:     aws.Int32(300),
+	}
+	vm := events.ViolatingMetric{Dimensions: map[string]string{"InstanceId": "i-0abc", "AutoScalingGroupName": "web"}}
+	window := &events.TimeWindow{
+		Start: time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC),
+		End:   time.Date(2025, 10, 2, 6, 15, 0, 0, time.UTC),
+	}
+
+	got := MetricURL("us-east-1", alarm, vm, window)
+
+	assert.Equal(t, "https://us-east-1.console.aws.amazon.com/cloudwatch/home?region=us-east-1#metricsV2:graph="+
+		"~(view~'timeSeries~stacked~false~region~'us-east-1"+
+		"~metrics~(~(~'AWS*2fEC2~'CPUUtilization~'AutoScalingGroupName~'web~'InstanceId~'i-0abc))"+
+		"~stat~'Average~period~300~start~'2025-10-02T06*3a00*3a00Z~end~'2025-10-02T06*3a15*3a00Z)", got)
+}
+
+func TestMetricURL_MetricMath(t *testing.T) {
+	alarm := &types.MetricAlarm{
+		AlarmName: aws.String("error-rate"),
+		Metrics: []types.MetricDataQuery{
+			{Id: aws.String("e1"), Expression: aws.String("100*errors/requests"), ReturnData: aws.Bool(true)},
+			{
+				Id: aws.String("errors"),
+				MetricStat: &types.MetricStat{
+					Metric: &types.Metric{Namespace: aws.String("AWS/Lambda"), MetricName: aws.String("Errors")},
+					Period: aws.Int32(60),
+					Stat:   aws.String("Sum"),
+				},
+				ReturnData: aws.Bool(false),
+			},
+		},
+	}
+	vm := events.ViolatingMetric{Dimensions: map[string]string{"FunctionName": "checkout"}}
+
+	got := MetricURL("us-east-1", alarm, vm, nil)
+
+	assert.Contains(t, got, "~metrics~(~(~(expression~'100*2aerrors*2frequests~id~'e1))"+
+		"~(~'AWS*2fLambda~'Errors~'FunctionName~'checkout~(id~'errors~visible~false~stat~'Sum~period~60)))")
+	assert.NotContains(t, got, "~start~")
+}
+
+func TestAdd(t *testing.T) {
+	event := &events.EnrichedEvent{
+		Alarm: &types.MetricAlarm{
+			AlarmName:  aws.String("cpu-high"),
+			Namespace:  aws.String("AWS/EC2"),
+			MetricName: aws.String("CPUUtilization"),
+		},
+		ViolatingMetrics: []events.ViolatingMetric{{Dimensions: map[string]string{"InstanceId": "i-0abc"}}},
+	}
+
+	Add(event, "eu-central-1")
+
+	assert.Equal(t, AlarmURL("eu-central-1", "cpu-high"), event.AlarmURL)
+	assert.Contains(t, event.ViolatingMetrics[0].ConsoleURL, "region=eu-central-1#metricsV2:graph=")
+}
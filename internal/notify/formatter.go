@@ -14,50 +14,376 @@ import (
 )
 
 // FormatText converts an enriched event to a human-readable text message.
+// Recoveries are formatted with FormatRecoveryText.
 func FormatText(event *events.EnrichedEvent) (string, error) {
-	a := event.Alarm
+	if event.IsRecovery() {
+		return FormatRecoveryText(event), nil
+	}
+
 	var msg strings.Builder
 
 	msg.WriteString("CloudWatch Alarm: ")
-	msg.WriteString(aws.ToString(a.AlarmName))
+	msg.WriteString(event.AlarmName())
 	msg.WriteString("\nState: ")
-	msg.WriteString(string(event.Alarm.StateValue))
+	msg.WriteString(string(event.StateValue()))
+	if event.StateChange != nil && event.StateChange.PreviousState.Value != "" {
+		msg.WriteString(" (previously ")
+		msg.WriteString(string(event.StateChange.PreviousState.Value))
+		msg.WriteString(")")
+	}
 	msg.WriteString("\nAccountID: ")
 	msg.WriteString(event.AccountID)
+	if event.Region != "" {
+		msg.WriteString("\nRegion: ")
+		msg.WriteString(event.Region)
+	}
 	msg.WriteString("\nReason: ")
-	msg.WriteString(aws.ToString(a.StateReason))
+	msg.WriteString(event.StateReason())
+	if event.AlarmURL != "" {
+		msg.WriteString("\nConsole: ")
+		msg.WriteString(event.AlarmURL)
+	}
+	if event.GraphURL != "" {
+		msg.WriteString("\nGraph: ")
+		msg.WriteString(event.GraphURL)
+	}
 	msg.WriteString("\n\n")
 
-	if len(event.ViolatingMetrics) == 0 {
+	writePartial(&msg, event)
+
+	if event.CompositeAlarm != nil {
+		msg.WriteString("Rule: ")
+		msg.WriteString(aws.ToString(event.CompositeAlarm.AlarmRule))
+		msg.WriteString("\n\n")
+	}
+
+	switch {
+	case event.EnrichmentFailed():
+		// Nothing is known beyond the alarm itself.
+	case event.CompositeAlarm != nil:
+		if err := writeChildAlarms(&msg, event.ChildAlarms, ""); err != nil {
+			return "", err
+		}
+	case event.StateValue() == types.StateValueInsufficientData:
+		writeSilentMetrics(&msg, event.SilentMetrics, event.OmittedSilentMetrics, event.Summary)
+		writeEnrichmentErrors(&msg, event.EnrichmentErrors, "")
+	default:
+		if err := writeViolatingMetrics(&msg, event.Alarm, event.ViolatingMetrics, event.OmittedViolatingMetrics, event.Summary, ""); err != nil {
+			return "", err
+		}
+		writeResolvedResources(&msg, event.ResolvedResources, "")
+		writeEnrichmentErrors(&msg, event.EnrichmentErrors, "")
+	}
+
+	fmt.Fprintf(&msg, "\nTimestamp: %s", event.Timestamp.Format(time.RFC3339))
+
+	return msg.String(), nil
+}
+
+func writeChildAlarms(msg *strings.Builder, children []events.ChildAlarm, indent string) error {
+	if len(children) == 0 {
+		msg.WriteString(indent)
+		msg.WriteString("No child alarms currently in ALARM state.\n")
+		return nil
+	}
+
+	msg.WriteString(indent)
+	msg.WriteString("Child alarms in ALARM state:\n")
+
+	for _, child := range children {
+		if child.CompositeAlarm != nil {
+			fmt.Fprintf(msg, "%s- %s (composite)\n", indent, aws.ToString(child.CompositeAlarm.AlarmName))
+			writeURL(msg, child.AlarmURL, indent+"  ")
+			if child.EnrichmentFailed() {
+				writeEnrichmentErrors(msg, child.EnrichmentErrors, indent+"  ")
+				continue
+			}
+			if err := writeChildAlarms(msg, child.ChildAlarms, indent+"  "); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fmt.Fprintf(msg, "%s- %s\n", indent, aws.ToString(child.Alarm.AlarmName))
+		writeURL(msg, child.AlarmURL, indent+"  ")
+		if child.EnrichmentFailed() {
+			writeEnrichmentErrors(msg, child.EnrichmentErrors, indent+"  ")
+			continue
+		}
+		if err := writeViolatingMetrics(msg, child.Alarm, child.ViolatingMetrics, child.OmittedViolatingMetrics, child.Summary, indent+"  "); err != nil {
+			return err
+		}
+		writeResolvedResources(msg, child.ResolvedResources, indent+"  ")
+		writeEnrichmentErrors(msg, child.EnrichmentErrors, indent+"  ")
+	}
+
+	return nil
+}
+
+func writeViolatingMetrics(
+	msg *strings.Builder,
+	alarm *types.MetricAlarm,
+	violatingMetrics []events.ViolatingMetric,
+	omitted int,
+	summary *events.ImpactSummary,
+	indent string,
+) error {
+	writeSummary(msg, summary, indent)
+
+	if len(violatingMetrics) == 0 {
+		msg.WriteString(indent)
 		msg.WriteString("No specific services currently violating the threshold.\n")
+		return nil
+	}
+
+	band := events.IsBandComparison(alarm.ComparisonOperator)
+
+	if band {
+		fmt.Fprintf(msg, "%sMetrics currently outside the expected band:\n", indent)
 	} else {
-		symbol, err := getComparisonSymbol(event.Alarm.ComparisonOperator)
+		symbol, err := getComparisonSymbol(alarm.ComparisonOperator)
 		if err != nil {
-			return "", err
+			return err
 		}
 
-		fmt.Fprintf(&msg, "Metrics currently violating (%s %.1f) threshold:\n",
+		fmt.Fprintf(msg, "%sMetrics currently violating (%s %.1f) threshold:\n",
+			indent,
 			symbol,
-			aws.ToFloat64(event.Alarm.Threshold))
+			aws.ToFloat64(alarm.Threshold))
+	}
+
+	for i, vm := range violatingMetrics {
+		fmt.Fprintf(msg, "%s%d. %s, ", indent, i+1, formatPairs(vm.Dimensions))
+
+		if band && vm.Band != nil {
+			fmt.Fprintf(msg, "expected %.2f–%.2f, got %.2f", vm.Band.Lower, vm.Band.Upper, vm.Value)
+		} else {
+			fmt.Fprintf(msg, "Value: %.2f", vm.Value)
+		}
+
+		if vm.EvaluatedDatapoints > 0 {
+			fmt.Fprintf(msg, ", Breaching: %d/%d", vm.BreachingDatapoints, vm.EvaluatedDatapoints)
+		}
+
+		switch vm.Status {
+		case events.ViolationNew:
+			msg.WriteString(", New")
+		case events.ViolationOngoing:
+			fmt.Fprintf(msg, ", Violating since: %s", vm.FirstSeen.Format(time.RFC3339))
+		}
+
+		if len(vm.History) > 1 {
+			fmt.Fprintf(msg, ", Trend: %s", sparkline(vm.History))
+		}
+
+		if len(vm.Tags) > 0 {
+			fmt.Fprintf(msg, " (%s)", formatPairs(vm.Tags))
+		}
+
+		msg.WriteString("\t\n")
+
+		writeURL(msg, vm.ConsoleURL, indent+"   ")
+	}
+
+	if omitted > 0 {
+		fmt.Fprintf(msg, "%s... and %d more\n", indent, omitted)
+	}
+
+	return nil
+}
+
+// writeSilentMetrics lists the metrics that stopped reporting with the time they were last seen.
+func writeSilentMetrics(msg *strings.Builder, silentMetrics []events.ViolatingMetric, omitted int, summary *events.ImpactSummary) {
+	writeSilentSummary(msg, summary, len(silentMetrics)+omitted)
+
+	if len(silentMetrics) == 0 {
+		msg.WriteString("No metrics found that stopped reporting.\n")
+		return
+	}
 
-		for i, vm := range event.ViolatingMetrics {
-			dms := make([]string, 0, len(vm.Dimensions))
-			for k, v := range vm.Dimensions {
-				dms = append(dms, k+"="+v)
+	msg.WriteString("Metrics that stopped reporting:\n")
+
+	for i, vm := range silentMetrics {
+		fmt.Fprintf(msg, "%d. %s, last seen %s (Value: %.2f)",
+			i+1, formatPairs(vm.Dimensions), vm.Timestamp.Format(time.RFC3339), vm.Value)
+
+		if len(vm.Tags) > 0 {
+			fmt.Fprintf(msg, " (%s)", formatPairs(vm.Tags))
+		}
+
+		msg.WriteString("\t\n")
+
+		writeURL(msg, vm.ConsoleURL, "   ")
+	}
+
+	if omitted > 0 {
+		fmt.Fprintf(msg, "... and %d more\n", omitted)
+	}
+}
+
+// writeResolvedResources lists the resources that stopped violating since the previous notification.
+func writeResolvedResources(msg *strings.Builder, resources []events.ResolvedResource, indent string) {
+	if len(resources) == 0 {
+		return
+	}
+
+	fmt.Fprintf(msg, "%sResolved since the previous notification:\n", indent)
+
+	for _, r := range resources {
+		fmt.Fprintf(msg, "%s- %s (violating from %s to %s)\n",
+			indent,
+			formatPairs(r.Dimensions),
+			r.FirstSeen.Format(time.RFC3339),
+			r.LastSeen.Format(time.RFC3339))
+	}
+}
+
+// writeSummary writes how many of the resources the alarm covers are violating, e.g.
+// "Impact: 7 of 120 resources violating (110 healthy, 3 no data)".
+func writeSummary(msg *strings.Builder, summary *events.ImpactSummary, indent string) {
+	if summary == nil || summary.Candidates == 0 {
+		return
+	}
+
+	fmt.Fprintf(msg, "%sImpact: %d of %d resources violating", indent, summary.Violating, summary.Candidates)
+
+	var details []string
+	if summary.Healthy > 0 {
+		details = append(details, fmt.Sprintf("%d healthy", summary.Healthy))
+	}
+	if summary.NoData > 0 {
+		details = append(details, fmt.Sprintf("%d no data", summary.NoData))
+	}
+	if summary.Incomplete > 0 {
+		details = append(details, fmt.Sprintf("%d incomplete", summary.Incomplete))
+	}
+	if summary.Failed > 0 {
+		details = append(details, fmt.Sprintf("%d not evaluated", summary.Failed))
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(msg, " (%s)", strings.Join(details, ", "))
+	}
+
+	msg.WriteString("\n")
+}
+
+// writeSilentSummary sums up the resources of an alarm in INSUFFICIENT_DATA state: those without
+// data in the evaluation window, of which silent stopped reporting during it, and the others.
+func writeSilentSummary(msg *strings.Builder, summary *events.ImpactSummary, silent int) {
+	if summary == nil || summary.Candidates == 0 {
+		return
+	}
+
+	fmt.Fprintf(msg, "Impact: %d of %d resources without data", summary.NoData, summary.Candidates)
+
+	var details []string
+	if silent > 0 {
+		details = append(details, fmt.Sprintf("%d stopped reporting", silent))
+	}
+	if reporting := summary.Violating + summary.Healthy; reporting > 0 {
+		details = append(details, fmt.Sprintf("%d reporting", reporting))
+	}
+	if summary.Incomplete > 0 {
+		details = append(details, fmt.Sprintf("%d incomplete", summary.Incomplete))
+	}
+	if summary.Failed > 0 {
+		details = append(details, fmt.Sprintf("%d not evaluated", summary.Failed))
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(msg, " (%s)", strings.Join(details, ", "))
+	}
+
+	msg.WriteString("\n")
+}
+
+// maxIncompleteListed is the number of resources with incomplete data listed per batch.
+const maxIncompleteListed = 5
+
+// writePartial warns that the event lists only the resources that could be evaluated, or none at
+// all when enrichment failed.
+func writePartial(msg *strings.Builder, event *events.EnrichedEvent) {
+	switch {
+	case event.EnrichmentFailed():
+		msg.WriteString("Enrichment failed; the resources behind the alarm could not be determined: ")
+		msg.WriteString(event.EnrichmentFailure)
+		msg.WriteString("\n\n")
+	case event.Partial:
+		msg.WriteString("Partial results: some resources could not be evaluated, so violating resources may be missing.\n\n")
+	}
+}
+
+// writeEnrichmentErrors lists the batches that failed and the resources whose data was incomplete.
+func writeEnrichmentErrors(msg *strings.Builder, errs []events.EnrichmentError, indent string) {
+	if len(errs) == 0 {
+		return
+	}
+
+	fmt.Fprintf(msg, "%sEnrichment errors:\n", indent)
+
+	for _, e := range errs {
+		switch e.Reason {
+		case events.EnrichmentBatchFailed:
+			fmt.Fprintf(msg, "%s- batch %d: %d resources not evaluated: %s\n", indent, e.Batch, e.Metrics, e.Message)
+		case events.EnrichmentAlarmFailed:
+			fmt.Fprintf(msg, "%s- alarm not evaluated: %s\n", indent, e.Message)
+		case events.EnrichmentCandidatesSampled:
+			fmt.Fprintf(msg, "%s- %d resources not evaluated: %s\n", indent, e.Metrics, e.Message)
+		case events.EnrichmentDataIncomplete:
+			fmt.Fprintf(msg, "%s- batch %d: %d resources with incomplete data\n", indent, e.Batch, e.Metrics)
+			for _, dims := range e.Dimensions[:min(len(e.Dimensions), maxIncompleteListed)] {
+				fmt.Fprintf(msg, "%s   %s\n", indent, formatPairs(dims))
+			}
+			if len(e.Dimensions) > maxIncompleteListed {
+				fmt.Fprintf(msg, "%s   ... and %d more\n", indent, len(e.Dimensions)-maxIncompleteListed)
 			}
+		}
+	}
+}
+
+func writeURL(msg *strings.Builder, url, indent string) {
+	if url == "" {
+		return
+	}
+
+	msg.WriteString(indent)
+	msg.WriteString(url)
+	msg.WriteString("\n")
+}
 
-			slices.Sort(dms)
+// sparkTicks are the bar characters of a sparkline, lowest to highest.
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
 
-			fmt.Fprintf(&msg, "%d. %s, Value: %.2f\t\n",
-				i+1,
-				strings.Join(dms, ", "),
-				vm.Value)
+// sparkline renders a series as unicode bars scaled between its minimum and maximum.
+// A flat series renders as a row of the lowest bar.
+func sparkline(series []events.Datapoint) string {
+	lo, hi := series[0].Value, series[0].Value
+	for _, p := range series {
+		lo = min(lo, p.Value)
+		hi = max(hi, p.Value)
+	}
+
+	ticks := make([]rune, len(series))
+	for i, p := range series {
+		tick := 0
+		if hi > lo {
+			tick = int((p.Value - lo) / (hi - lo) * float64(len(sparkTicks)-1))
 		}
+		ticks[i] = sparkTicks[tick]
 	}
 
-	fmt.Fprintf(&msg, "\nTimestamp: %s", event.Timestamp.Format(time.RFC3339))
+	return string(ticks)
+}
 
-	return msg.String(), nil
+// formatPairs renders a map as comma-separated key=value pairs sorted by key.
+func formatPairs(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+
+	slices.Sort(pairs)
+
+	return strings.Join(pairs, ", ")
 }
 
 func getComparisonSymbol(op types.ComparisonOperator) (string, error) {
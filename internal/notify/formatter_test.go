@@ -0,0 +1,298 @@
+package notify
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+func TestFormatText_InsufficientDataSummary(t *testing.T) {
+	event := &events.EnrichedEvent{
+		Alarm: &types.MetricAlarm{
+			AlarmName:  aws.String("cpu-high"),
+			StateValue: types.StateValueInsufficientData,
+		},
+		SilentMetrics: []events.ViolatingMetric{{
+			Dimensions: map[string]string{"InstanceId": "i-a"},
+			Value:      20,
+			Timestamp:  time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC),
+		}},
+		OmittedSilentMetrics: 2,
+		ViolatingMetrics:     []events.ViolatingMetric{},
+		Summary: &events.ImpactSummary{
+			Candidates: 10,
+			Healthy:    4,
+			NoData:     5,
+			Incomplete: 1,
+		},
+	}
+
+	text, err := FormatText(event)
+	require.NoError(t, err)
+	assert.Contains(t, text, "Impact: 5 of 10 resources without data (3 stopped reporting, 4 reporting, 1 incomplete)\n")
+	assert.NotContains(t, text, "violating")
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   string
+	}{
+		{name: "scaled between min and max", values: []float64{1, 2, 3, 4, 5, 6, 7, 8}, want: "▁▂▃▄▅▆▇█"},
+		{name: "scaled with negative values", values: []float64{-10, 4, 0}, want: "▁█▆"},
+		{name: "flat series", values: []float64{5, 5, 5}, want: "▁▁▁"},
+		{name: "single point", values: []float64{42}, want: "▁"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := make([]events.Datapoint, len(tt.values))
+			for i, v := range tt.values {
+				series[i] = events.Datapoint{Value: v}
+			}
+
+			assert.Equal(t, tt.want, sparkline(series))
+		})
+	}
+}
+
+func TestFormatText_AnomalyBand(t *testing.T) {
+	event := &events.EnrichedEvent{
+		Alarm: &types.MetricAlarm{
+			AlarmName:          aws.String("latency-anomaly"),
+			StateValue:         types.StateValueAlarm,
+			ComparisonOperator: types.ComparisonOperatorLessThanLowerOrGreaterThanUpperThreshold,
+			ThresholdMetricId:  aws.String("ad1"),
+		},
+		ViolatingMetrics: []events.ViolatingMetric{{
+			Dimensions: map[string]string{"LoadBalancer": "app/web"},
+			Value:      150,
+			Band:       &events.Band{Lower: 80, Upper: 120},
+		}},
+	}
+
+	text, err := FormatText(event)
+	require.NoError(t, err)
+	assert.Contains(t, text, "Metrics currently outside the expected band:\n")
+	assert.Contains(t, text, "1. LoadBalancer=app/web, expected 80.00–120.00, got 150.00\t\n")
+	assert.NotContains(t, text, "threshold")
+}
+
+func TestFormatText_Region(t *testing.T) {
+	event := &events.EnrichedEvent{
+		AccountID: "123456789012",
+		Region:    "eu-west-1",
+		Alarm: &types.MetricAlarm{
+			AlarmName:  aws.String("cpu-high"),
+			StateValue: types.StateValueAlarm,
+		},
+	}
+
+	text, err := FormatText(event)
+	require.NoError(t, err)
+	assert.Contains(t, text, "\nAccountID: 123456789012\nRegion: eu-west-1\nReason: ")
+
+	event.Region = ""
+	text, err = FormatText(event)
+	require.NoError(t, err)
+	assert.NotContains(t, text, "Region:")
+}
+
+func TestFormatText_Links(t *testing.T) {
+	event := &events.EnrichedEvent{
+		AlarmURL: "https://console.aws.amazon.com/cloudwatch/home#alarmsV2:alarm/cpu-high",
+		GraphURL: "https://snapshots.example.com/cpu-high.png",
+		Alarm: &types.MetricAlarm{
+			AlarmName:          aws.String("cpu-high"),
+			StateValue:         types.StateValueAlarm,
+			ComparisonOperator: types.ComparisonOperatorGreaterThanThreshold,
+			Threshold:          aws.Float64(80),
+		},
+		ViolatingMetrics: []events.ViolatingMetric{{
+			Dimensions: map[string]string{"InstanceId": "i-a"},
+			Value:      95,
+			ConsoleURL: "https://console.aws.amazon.com/cloudwatch/home#metricsV2:graph=i-a",
+		}},
+	}
+
+	text, err := FormatText(event)
+	require.NoError(t, err)
+	assert.Contains(t, text, "\nConsole: https://console.aws.amazon.com/cloudwatch/home#alarmsV2:alarm/cpu-high"+
+		"\nGraph: https://snapshots.example.com/cpu-high.png\n")
+	assert.Contains(t, text, "1. InstanceId=i-a, Value: 95.00\t\n"+
+		"   https://console.aws.amazon.com/cloudwatch/home#metricsV2:graph=i-a\n")
+
+	event.AlarmURL, event.GraphURL = "", ""
+	text, err = FormatText(event)
+	require.NoError(t, err)
+	assert.NotContains(t, text, "Console:")
+	assert.NotContains(t, text, "Graph:")
+}
+
+func TestFormatText_OmittedViolatingMetrics(t *testing.T) {
+	event := &events.EnrichedEvent{
+		Alarm: &types.MetricAlarm{
+			AlarmName:          aws.String("cpu-high"),
+			StateValue:         types.StateValueAlarm,
+			ComparisonOperator: types.ComparisonOperatorGreaterThanThreshold,
+			Threshold:          aws.Float64(80),
+		},
+		ViolatingMetrics: []events.ViolatingMetric{
+			{Dimensions: map[string]string{"InstanceId": "i-a"}, Value: 99},
+			{Dimensions: map[string]string{"InstanceId": "i-b"}, Value: 90},
+		},
+		OmittedViolatingMetrics: 3,
+	}
+
+	text, err := FormatText(event)
+	require.NoError(t, err)
+	assert.Contains(t, text, "1. InstanceId=i-a, Value: 99.00\t\n2. InstanceId=i-b, Value: 90.00\t\n... and 3 more\n")
+
+	event.OmittedViolatingMetrics = 0
+	text, err = FormatText(event)
+	require.NoError(t, err)
+	assert.NotContains(t, text, "more")
+}
+
+func TestFormatText_ImpactSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary *events.ImpactSummary
+		want    string
+	}{
+		{
+			name:    "all outcomes",
+			summary: &events.ImpactSummary{Candidates: 120, Violating: 7, Healthy: 105, NoData: 3, Incomplete: 2, Failed: 3},
+			want:    "Impact: 7 of 120 resources violating (105 healthy, 3 no data, 2 incomplete, 3 not evaluated)\n",
+		},
+		{
+			name:    "violating only",
+			summary: &events.ImpactSummary{Candidates: 1, Violating: 1},
+			want:    "Impact: 1 of 1 resources violating\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &events.EnrichedEvent{
+				Alarm: &types.MetricAlarm{
+					AlarmName:          aws.String("cpu-high"),
+					StateValue:         types.StateValueAlarm,
+					ComparisonOperator: types.ComparisonOperatorGreaterThanThreshold,
+					Threshold:          aws.Float64(80),
+				},
+				ViolatingMetrics: []events.ViolatingMetric{{Dimensions: map[string]string{"InstanceId": "i-a"}, Value: 95}},
+				Summary:          tt.summary,
+			}
+
+			text, err := FormatText(event)
+			require.NoError(t, err)
+			assert.Contains(t, text, "\n\n"+tt.want+"Metrics currently violating (> 80.0) threshold:\n")
+		})
+	}
+}
+
+func TestFormatText_NoImpactSummaryWithoutCandidates(t *testing.T) {
+	event := &events.EnrichedEvent{
+		Alarm: &types.MetricAlarm{
+			AlarmName:  aws.String("cpu-high"),
+			StateValue: types.StateValueAlarm,
+		},
+		Summary: &events.ImpactSummary{},
+	}
+
+	text, err := FormatText(event)
+	require.NoError(t, err)
+	assert.NotContains(t, text, "Impact:")
+}
+
+func TestFormatText_PartialResults(t *testing.T) {
+	incomplete := make([]map[string]string, 7)
+	for i := range incomplete {
+		incomplete[i] = map[string]string{"InstanceId": fmt.Sprintf("i-%d", i)}
+	}
+
+	event := &events.EnrichedEvent{
+		Alarm: &types.MetricAlarm{
+			AlarmName:          aws.String("cpu-high"),
+			StateValue:         types.StateValueAlarm,
+			ComparisonOperator: types.ComparisonOperatorGreaterThanThreshold,
+			Threshold:          aws.Float64(80),
+		},
+		ViolatingMetrics: []events.ViolatingMetric{{Dimensions: map[string]string{"InstanceId": "i-a"}, Value: 95}},
+		Partial:          true,
+		EnrichmentErrors: []events.EnrichmentError{
+			{Reason: events.EnrichmentBatchFailed, Batch: 2, Metrics: 500, Message: "ThrottlingException: Rate exceeded"},
+			{Reason: events.EnrichmentDataIncomplete, Batch: 1, Metrics: 7, Dimensions: incomplete},
+			{Reason: events.EnrichmentCandidatesSampled, Metrics: 40, Message: "alarm covers 1040 resources, evaluated 1000"},
+		},
+	}
+
+	text, err := FormatText(event)
+	require.NoError(t, err)
+	assert.Contains(t, text, "\n\nPartial results: some resources could not be evaluated, so violating resources may be missing.\n\n")
+	assert.Contains(t, text, "Enrichment errors:\n"+
+		"- batch 2: 500 resources not evaluated: ThrottlingException: Rate exceeded\n"+
+		"- batch 1: 7 resources with incomplete data\n"+
+		"   InstanceId=i-0\n"+
+		"   InstanceId=i-1\n"+
+		"   InstanceId=i-2\n"+
+		"   InstanceId=i-3\n"+
+		"   InstanceId=i-4\n"+
+		"   ... and 2 more\n"+
+		"- 40 resources not evaluated: alarm covers 1040 resources, evaluated 1000\n")
+}
+
+func TestFormatText_CompositeChildFailed(t *testing.T) {
+	event := &events.EnrichedEvent{
+		CompositeAlarm: &types.CompositeAlarm{
+			AlarmName:  aws.String("service-down"),
+			AlarmRule:  aws.String(`ALARM("cpu-high")`),
+			StateValue: types.StateValueAlarm,
+		},
+		Partial: true,
+		ChildAlarms: []events.ChildAlarm{{
+			Alarm: &types.MetricAlarm{AlarmName: aws.String("cpu-high")},
+			EnrichmentErrors: []events.EnrichmentError{
+				{Reason: events.EnrichmentAlarmFailed, Message: "AccessDenied"},
+			},
+		}},
+	}
+
+	text, err := FormatText(event)
+	require.NoError(t, err)
+	assert.Contains(t, text, "Partial results:")
+	assert.Contains(t, text, "Child alarms in ALARM state:\n- cpu-high\n  Enrichment errors:\n  - alarm not evaluated: AccessDenied\n")
+}
+
+func TestFormatText_Fallback(t *testing.T) {
+	event := &events.EnrichedEvent{
+		AccountID: "123456789012",
+		Timestamp: time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC),
+		Alarm: &types.MetricAlarm{
+			AlarmName:   aws.String("cpu-high"),
+			StateValue:  types.StateValueAlarm,
+			StateReason: aws.String("Threshold Crossed"),
+		},
+		ViolatingMetrics:  []events.ViolatingMetric{},
+		Partial:           true,
+		EnrichmentFailure: "describe alarm: context deadline exceeded",
+	}
+
+	text, err := FormatText(event)
+	require.NoError(t, err)
+	assert.Equal(t, "CloudWatch Alarm: cpu-high\n"+
+		"State: ALARM\n"+
+		"AccountID: 123456789012\n"+
+		"Reason: Threshold Crossed\n\n"+
+		"Enrichment failed; the resources behind the alarm could not be determined: describe alarm: context deadline exceeded\n\n"+
+		"\nTimestamp: 2025-10-02T06:00:00Z", text)
+}
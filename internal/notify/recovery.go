@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// FormatRecoveryText converts the enriched event of an alarm that returned to OK state to a
+// human-readable text message listing the incident and the resources it resolved.
+func FormatRecoveryText(event *events.EnrichedEvent) string {
+	var msg strings.Builder
+
+	r := event.Recovery
+
+	msg.WriteString("CloudWatch Alarm Recovered: ")
+	msg.WriteString(event.AlarmName())
+	msg.WriteString("\nState: OK (previously ALARM)")
+	msg.WriteString("\nAccountID: ")
+	msg.WriteString(event.AccountID)
+	if event.Region != "" {
+		msg.WriteString("\nRegion: ")
+		msg.WriteString(event.Region)
+	}
+	fmt.Fprintf(&msg, "\nIncident: %s to %s (lasted %s)",
+		r.AlarmedAt.Format(time.RFC3339),
+		r.RecoveredAt.Format(time.RFC3339),
+		r.Duration())
+	msg.WriteString("\nReason: ")
+	msg.WriteString(event.StateReason())
+	if event.AlarmURL != "" {
+		msg.WriteString("\nConsole: ")
+		msg.WriteString(event.AlarmURL)
+	}
+	if event.GraphURL != "" {
+		msg.WriteString("\nGraph: ")
+		msg.WriteString(event.GraphURL)
+	}
+	msg.WriteString("\n\n")
+
+	writePartial(&msg, event)
+
+	if event.Alarm != nil && !event.EnrichmentFailed() {
+		writeResolvedMetrics(&msg, r)
+		writeEnrichmentErrors(&msg, event.EnrichmentErrors, "")
+	}
+
+	fmt.Fprintf(&msg, "\nTimestamp: %s", event.Timestamp.Format(time.RFC3339))
+
+	return msg.String()
+}
+
+func writeResolvedMetrics(msg *strings.Builder, r *events.Recovery) {
+	if len(r.ResolvedMetrics) == 0 {
+		msg.WriteString("No specific services resolved.\n")
+	} else {
+		msg.WriteString("Resolved metrics:\n")
+
+		for i, vm := range r.ResolvedMetrics {
+			fmt.Fprintf(msg, "%d. %s, Value: %.2f", i+1, formatPairs(vm.Dimensions), vm.Value)
+
+			if !vm.FirstSeen.IsZero() {
+				fmt.Fprintf(msg, ", Violating since: %s", vm.FirstSeen.Format(time.RFC3339))
+			}
+
+			if len(vm.Tags) > 0 {
+				fmt.Fprintf(msg, " (%s)", formatPairs(vm.Tags))
+			}
+
+			msg.WriteString("\t\n")
+
+			writeURL(msg, vm.ConsoleURL, "   ")
+		}
+
+		if r.OmittedResolvedMetrics > 0 {
+			fmt.Fprintf(msg, "... and %d more\n", r.OmittedResolvedMetrics)
+		}
+	}
+
+	if r.StillViolating > 0 {
+		fmt.Fprintf(msg, "%d metrics that raised the alarm still violate the threshold.\n", r.StillViolating)
+	}
+}
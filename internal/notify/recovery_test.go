@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+var (
+	alarmedAt   = time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC)
+	recoveredAt = time.Date(2025, 10, 2, 7, 30, 0, 0, time.UTC)
+)
+
+func newRecoveryEvent() *events.EnrichedEvent {
+	return &events.EnrichedEvent{
+		AccountID: "111111111111",
+		Region:    "eu-north-1",
+		Timestamp: recoveredAt,
+		Alarm: &types.MetricAlarm{
+			AlarmName:   aws.String("cpu-high"),
+			StateValue:  types.StateValueOk,
+			StateReason: aws.String("Threshold Crossed: 1 datapoint [20.0] was not greater than the threshold (50.0)."),
+		},
+		Recovery: &events.Recovery{
+			AlarmedAt:       alarmedAt,
+			RecoveredAt:     recoveredAt,
+			DurationSeconds: int64(recoveredAt.Sub(alarmedAt).Seconds()),
+			ResolvedMetrics: []events.ViolatingMetric{{
+				Dimensions: map[string]string{"InstanceId": "i-a"},
+				Value:      20,
+				FirstSeen:  alarmedAt,
+			}},
+			OmittedResolvedMetrics: 4,
+			StillViolating:         2,
+		},
+		ViolatingMetrics: []events.ViolatingMetric{},
+	}
+}
+
+func TestFormatRecoveryText(t *testing.T) {
+	want := "CloudWatch Alarm Recovered: cpu-high\n" +
+		"State: OK (previously ALARM)\n" +
+		"AccountID: 111111111111\n" +
+		"Region: eu-north-1\n" +
+		"Incident: 2025-10-02T06:00:00Z to 2025-10-02T07:30:00Z (lasted 1h30m0s)\n" +
+		"Reason: Threshold Crossed: 1 datapoint [20.0] was not greater than the threshold (50.0).\n" +
+		"\n" +
+		"Resolved metrics:\n" +
+		"1. InstanceId=i-a, Value: 20.00, Violating since: 2025-10-02T06:00:00Z\t\n" +
+		"... and 4 more\n" +
+		"2 metrics that raised the alarm still violate the threshold.\n" +
+		"\n" +
+		"Timestamp: 2025-10-02T07:30:00Z"
+
+	assert.Equal(t, want, FormatRecoveryText(newRecoveryEvent()))
+}
+
+func TestFormatRecoveryText_FallbackListsNoResources(t *testing.T) {
+	event := newRecoveryEvent()
+	event.Recovery.ResolvedMetrics = nil
+	event.Recovery.OmittedResolvedMetrics = 0
+	event.Recovery.StillViolating = 0
+	event.Partial = true
+	event.EnrichmentFailure = "throttled"
+
+	text := FormatRecoveryText(event)
+	assert.Contains(t, text, "Enrichment failed; the resources behind the alarm could not be determined: throttled\n")
+	assert.NotContains(t, text, "No specific services resolved.")
+}
+
+func TestFormatRecoveryText_Links(t *testing.T) {
+	event := newRecoveryEvent()
+	event.AlarmURL = "https://console.aws.amazon.com/cloudwatch/home#alarmsV2:alarm/cpu-high"
+	event.GraphURL = "https://snapshots.s3.amazonaws.com/cpu-high.png"
+
+	assert.Contains(t, FormatRecoveryText(event), "\n"+
+		"Console: https://console.aws.amazon.com/cloudwatch/home#alarmsV2:alarm/cpu-high\n"+
+		"Graph: https://snapshots.s3.amazonaws.com/cpu-high.png\n\n")
+}
+
+func TestFormatText_Recovery(t *testing.T) {
+	event := newRecoveryEvent()
+
+	text, err := FormatText(event)
+	require.NoError(t, err)
+	assert.Equal(t, FormatRecoveryText(event), text)
+}
+
+// fakeSNS records the messages published to it.
+type fakeSNS struct {
+	inputs []*sns.PublishInput
+}
+
+func (f *fakeSNS) Publish(
+	_ context.Context,
+	input *sns.PublishInput,
+	_ ...func(*sns.Options),
+) (*sns.PublishOutput, error) {
+	f.inputs = append(f.inputs, input)
+	return &sns.PublishOutput{}, nil
+}
+
+func TestSNS_Subject(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   *events.EnrichedEvent
+		subject string
+	}{
+		{
+			name: "alarm",
+			event: &events.EnrichedEvent{
+				Alarm:            &types.MetricAlarm{AlarmName: aws.String("cpu-high"), StateValue: types.StateValueAlarm},
+				ViolatingMetrics: []events.ViolatingMetric{},
+			},
+			subject: "CloudWatch Alarm - cpu-high",
+		},
+		{
+			name:    "recovery",
+			event:   newRecoveryEvent(),
+			subject: "CloudWatch Alarm Recovered - cpu-high",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeSNS{}
+			require.NoError(t, NewSNS(client, "arn:aws:sns:eu-north-1:111111111111:alarms").Send(context.Background(), tt.event))
+
+			require.Len(t, client.inputs, 1)
+			assert.Equal(t, tt.subject, aws.ToString(client.inputs[0].Subject))
+		})
+	}
+}
@@ -42,7 +42,7 @@ func (s *SNS) Send(ctx context.Context, event *events.EnrichedEvent) error {
 	defer span.End()
 	span.SetAttributes(
 		attribute.String("sns.topic_arn", s.topicARN),
-		attribute.String("alarm.name", aws.ToString(event.Alarm.AlarmName)),
+		attribute.String("alarm.name", event.AlarmName()),
 	)
 
 	msg, err := FormatText(event)
@@ -50,9 +50,14 @@ func (s *SNS) Send(ctx context.Context, event *events.EnrichedEvent) error {
 		return fmt.Errorf("cannot format message: %w", err)
 	}
 
+	subject := "CloudWatch Alarm - " + event.AlarmName()
+	if event.IsRecovery() {
+		subject = "CloudWatch Alarm Recovered - " + event.AlarmName()
+	}
+
 	input := &sns.PublishInput{
 		TopicArn: aws.String(s.topicARN),
-		Subject:  aws.String("CloudWatch Alarm - " + aws.ToString(event.Alarm.AlarmName)),
+		Subject:  aws.String(subject),
 		Message:  aws.String(msg),
 	}
 
@@ -17,6 +17,18 @@ import (
 
 var tracer = otel.Tracer("github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/publish")
 
+const (
+	// Source is the source of the published events.
+	Source = "cloudwatch.alarm.enricher"
+
+	// DetailType is the detail-type of enriched alarm events.
+	DetailType = "Enriched CloudWatch Alarm"
+
+	// RecoveryDetailType is the detail-type of enriched events of alarms that returned to OK state,
+	// so that rules can route recoveries apart from alarms.
+	RecoveryDetailType = "Enriched CloudWatch Alarm Recovery"
+)
+
 // EventBridgeAPI defines required EventBridge operations.
 type EventBridgeAPI interface {
 	PutEvents(
@@ -45,7 +57,7 @@ func (p *Publisher) Publish(ctx context.Context, event *events.EnrichedEvent) er
 	defer span.End()
 	span.SetAttributes(
 		attribute.String("eventbus.name", p.eventBusName),
-		attribute.String("alarm.name", aws.ToString(event.Alarm.AlarmName)),
+		attribute.String("alarm.name", event.AlarmName()),
 	)
 
 	detail, err := json.Marshal(event)
@@ -53,12 +65,22 @@ func (p *Publisher) Publish(ctx context.Context, event *events.EnrichedEvent) er
 		return fmt.Errorf("cannot marshal event: %w", err)
 	}
 
+	detailType := DetailType
+	if event.IsRecovery() {
+		detailType = RecoveryDetailType
+	}
+	span.SetAttributes(
+		attribute.String("event.detail_type", detailType),
+		attribute.Bool("event.partial", event.Partial),
+		attribute.Bool("event.enrichment_failed", event.EnrichmentFailed()),
+	)
+
 	input := &eventbridge.PutEventsInput{
 		Entries: []types.PutEventsRequestEntry{{
 			Detail:       aws.String(string(detail)),
-			DetailType:   aws.String("Enriched CloudWatch Alarm"),
+			DetailType:   aws.String(detailType),
 			EventBusName: aws.String(p.eventBusName),
-			Source:       aws.String("cloudwatch.alarm.enricher"),
+			Source:       aws.String(Source),
 		}},
 	}
 
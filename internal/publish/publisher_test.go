@@ -0,0 +1,69 @@
+package publish
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// fakeEventBridge records the events put to it.
+type fakeEventBridge struct {
+	inputs []*eventbridge.PutEventsInput
+}
+
+func (f *fakeEventBridge) PutEvents(
+	_ context.Context,
+	input *eventbridge.PutEventsInput,
+	_ ...func(*eventbridge.Options),
+) (*eventbridge.PutEventsOutput, error) {
+	f.inputs = append(f.inputs, input)
+	return &eventbridge.PutEventsOutput{}, nil
+}
+
+func TestPublish_DetailType(t *testing.T) {
+	alarmedAt := time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		state      types.StateValue
+		recovery   *events.Recovery
+		detailType string
+	}{
+		{name: "alarm", state: types.StateValueAlarm, detailType: DetailType},
+		{name: "ok without recovery", state: types.StateValueOk, detailType: DetailType},
+		{
+			name:       "recovery",
+			state:      types.StateValueOk,
+			recovery:   &events.Recovery{AlarmedAt: alarmedAt, RecoveredAt: alarmedAt.Add(time.Hour), DurationSeconds: 3600},
+			detailType: RecoveryDetailType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeEventBridge{}
+			event := &events.EnrichedEvent{
+				Alarm:            &types.MetricAlarm{AlarmName: aws.String("cpu-high"), StateValue: tt.state},
+				Recovery:         tt.recovery,
+				ViolatingMetrics: []events.ViolatingMetric{},
+			}
+
+			require.NoError(t, NewPublisher(client, "alarms").Publish(context.Background(), event))
+
+			require.Len(t, client.inputs, 1)
+			require.Len(t, client.inputs[0].Entries, 1)
+			entry := client.inputs[0].Entries[0]
+			assert.Equal(t, tt.detailType, aws.ToString(entry.DetailType))
+			assert.Equal(t, Source, aws.ToString(entry.Source))
+			assert.Equal(t, "alarms", aws.ToString(entry.EventBusName))
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Package snapshot renders metric graph images of enriched alarms and stores them for notifications.
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+var tracer = otel.Tracer("github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/snapshot")
+
+const (
+	// DefaultTopN is the default number of violating resources drawn next to the alarm metric.
+	DefaultTopN = 5
+
+	// minGraphSpan is the shortest time range graphed; shorter evaluation windows get context before them.
+	minGraphSpan = 3 * time.Hour
+
+	imageWidth  = 800
+	imageHeight = 400
+)
+
+// WidgetAPI defines the CloudWatch operations required to render graphs.
+type WidgetAPI interface {
+	GetMetricWidgetImage(
+		ctx context.Context,
+		input *cloudwatch.GetMetricWidgetImageInput,
+		optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricWidgetImageOutput, error)
+}
+
+// ClientProvider returns the CloudWatch client for the account and region an alarm lives in.
+type ClientProvider interface {
+	Client(ctx context.Context, accountID, region string) (WidgetAPI, error)
+}
+
+// Snapshotter renders the graph of an enriched alarm and stores it.
+type Snapshotter struct {
+	clients ClientProvider
+	store   Store
+	topN    int
+}
+
+// NewSnapshotter creates a Snapshotter drawing up to topN violating resources.
+func NewSnapshotter(clients ClientProvider, store Store, topN int) *Snapshotter {
+	return &Snapshotter{
+		clients: clients,
+		store:   store,
+		topN:    topN,
+	}
+}
+
+// Attach renders the graph of a metric alarm's metric and its top violating resources, with the
+// threshold drawn as a line, stores the image and sets the event's GraphURL. Events without
+// violating metrics, such as composite alarms and alarms that are not in ALARM state, are left as is.
+func (s *Snapshotter) Attach(ctx context.Context, event *events.EnrichedEvent) error {
+	if event.Alarm == nil || event.EvaluationWindow == nil || len(event.ViolatingMetrics) == 0 {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, "snapshot.attach")
+	defer span.End()
+	span.SetAttributes(attribute.String("alarm.name", event.AlarmName()))
+
+	body, err := json.Marshal(s.widget(event))
+	if err != nil {
+		return fmt.Errorf("cannot marshal metric widget: %w", err)
+	}
+
+	client, err := s.clients.Client(ctx, event.AccountID, event.Region)
+	if err != nil {
+		return fmt.Errorf("cannot get cloudwatch client for account %s in %s: %w", event.AccountID, event.Region, err)
+	}
+
+	output, err := client.GetMetricWidgetImage(ctx, &cloudwatch.GetMetricWidgetImageInput{
+		MetricWidget: aws.String(string(body)),
+		OutputFormat: aws.String("png"),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot get metric widget image: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("snapshot.bytes", len(output.MetricWidgetImage)))
+
+	u, err := s.store.Put(ctx, objectKey(event), output.MetricWidgetImage, "image/png")
+	if err != nil {
+		return fmt.Errorf("cannot store snapshot: %w", err)
+	}
+
+	event.GraphURL = u
+
+	return nil
+}
+
+// widget is the subset of the CloudWatch metric widget definition used for snapshots.
+type widget struct {
+	Title       string       `json:"title"`
+	View        string       `json:"view"`
+	Stacked     bool         `json:"stacked"`
+	Metrics     [][]any      `json:"metrics"`
+	Stat        string       `json:"stat,omitempty"`
+	Period      int32        `json:"period,omitempty"`
+	Start       string       `json:"start"`
+	End         string       `json:"end"`
+	Width       int          `json:"width"`
+	Height      int          `json:"height"`
+	Annotations *annotations `json:"annotations,omitempty"`
+}
+
+type annotations struct {
+	Horizontal []annotation `json:"horizontal"`
+}
+
+type annotation struct {
+	Label string  `json:"label"`
+	Value float64 `json:"value"`
+}
+
+func (s *Snapshotter) widget(event *events.EnrichedEvent) widget {
+	alarm := event.Alarm
+	window := event.EvaluationWindow
+
+	start := window.End.Add(-max(minGraphSpan, 2*window.End.Sub(window.Start)))
+
+	w := widget{
+		Title:   event.AlarmName(),
+		View:    "timeSeries",
+		Metrics: s.widgetMetrics(alarm, event.ViolatingMetrics),
+		Start:   start.UTC().Format(time.RFC3339),
+		End:     window.End.UTC().Format(time.RFC3339),
+		Width:   imageWidth,
+		Height:  imageHeight,
+	}
+
+	if alarm.MetricName != nil {
+		w.Stat = string(alarm.Statistic)
+		if alarm.ExtendedStatistic != nil {
+			w.Stat = aws.ToString(alarm.ExtendedStatistic)
+		}
+		w.Period = aws.ToInt32(alarm.Period)
+	}
+
+	if alarm.Threshold != nil && !events.IsBandComparison(alarm.ComparisonOperator) {
+		w.Annotations = &annotations{
+			Horizontal: []annotation{{Label: "Threshold", Value: aws.ToFloat64(alarm.Threshold)}},
+		}
+	}
+
+	return w
+}
+
+// widgetMetrics draws the alarm metric as configured followed by the top violating resources.
+// Metric math alarms are drawn through their expressions only, as they are not broken down
+// per resource in a single widget.
+func (s *Snapshotter) widgetMetrics(alarm *types.MetricAlarm, violating []events.ViolatingMetric) [][]any {
+	if alarm.MetricName == nil {
+		metrics := make([][]any, 0, len(alarm.Metrics))
+		for _, q := range alarm.Metrics {
+			options := map[string]any{"id": aws.ToString(q.Id), "visible": aws.ToBool(q.ReturnData)}
+			if q.Label != nil {
+				options["label"] = aws.ToString(q.Label)
+			}
+
+			if q.MetricStat != nil && q.MetricStat.Metric != nil {
+				m := q.MetricStat.Metric
+				options["stat"] = aws.ToString(q.MetricStat.Stat)
+				options["period"] = aws.ToInt32(q.MetricStat.Period)
+				metrics = append(metrics, metricEntry(m.Namespace, m.MetricName, dimensionMap(m.Dimensions), options))
+				continue
+			}
+
+			options["expression"] = aws.ToString(q.Expression)
+			metrics = append(metrics, []any{options})
+		}
+		return metrics
+	}
+
+	metrics := [][]any{
+		metricEntry(alarm.Namespace, alarm.MetricName, dimensionMap(alarm.Dimensions),
+			map[string]any{"label": aws.ToString(alarm.AlarmName)}),
+	}
+
+	for _, vm := range violating[:min(s.topN, len(violating))] {
+		metrics = append(metrics, metricEntry(alarm.Namespace, alarm.MetricName, vm.Dimensions, nil))
+	}
+
+	return metrics
+}
+
+func metricEntry(namespace, metricName *string, dims map[string]string, options map[string]any) []any {
+	entry := []any{aws.ToString(namespace), aws.ToString(metricName)}
+
+	names := make([]string, 0, len(dims))
+	for name := range dims {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		entry = append(entry, name, dims[name])
+	}
+
+	if len(options) > 0 {
+		entry = append(entry, options)
+	}
+
+	return entry
+}
+
+func dimensionMap(dimensions []types.Dimension) map[string]string {
+	dims := make(map[string]string, len(dimensions))
+	for _, d := range dimensions {
+		dims[aws.ToString(d.Name)] = aws.ToString(d.Value)
+	}
+	return dims
+}
+
+// objectKey names a snapshot after the alarm and the end of its evaluation window.
+func objectKey(event *events.EnrichedEvent) string {
+	account := event.AccountID
+	if account == "" {
+		account = "unknown"
+	}
+
+	return account + "/" + url.PathEscape(event.AlarmName()) + "/" +
+		event.EvaluationWindow.End.UTC().Format("20060102T150405Z") + ".png"
+}
@@ -0,0 +1,179 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+var png = []byte("\x89PNG\r\n\x1a\n")
+
+// fakeWidgets records the widget it was asked to render and returns a fixed image.
+type fakeWidgets struct {
+	widget map[string]any
+}
+
+func (f *fakeWidgets) GetMetricWidgetImage(
+	_ context.Context,
+	input *cloudwatch.GetMetricWidgetImageInput,
+	_ ...func(*cloudwatch.Options),
+) (*cloudwatch.GetMetricWidgetImageOutput, error) {
+	if err := json.Unmarshal([]byte(aws.ToString(input.MetricWidget)), &f.widget); err != nil {
+		return nil, err
+	}
+	return &cloudwatch.GetMetricWidgetImageOutput{MetricWidgetImage: png}, nil
+}
+
+func (f *fakeWidgets) Client(context.Context, string, string) (WidgetAPI, error) {
+	return f, nil
+}
+
+func newEvent(violating int) *events.EnrichedEvent {
+	event := &events.EnrichedEvent{
+		AccountID: "111111111111",
+		Alarm: &types.MetricAlarm{
+			AlarmName:          aws.String("cpu/high"),
+			Namespace:          aws.String("AWS/EC2"),
+			MetricName:         aws.String("CPUUtilization"),
+			Statistic:          types.StatisticAverage,
+			Period:             aws.Int32(60),
+			Threshold:          aws.Float64(80),
+			ComparisonOperator: types.ComparisonOperatorGreaterThanThreshold,
+		},
+		EvaluationWindow: &events.TimeWindow{
+			Start: time.Date(2025, 10, 2, 5, 57, 0, 0, time.UTC),
+			End:   time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for i := range violating {
+		event.ViolatingMetrics = append(event.ViolatingMetrics, events.ViolatingMetric{
+			Dimensions: map[string]string{"InstanceId": "i-" + string(rune('a'+i))},
+		})
+	}
+
+	return event
+}
+
+func TestAttach(t *testing.T) {
+	widgets := &fakeWidgets{}
+	dir := t.TempDir()
+	snapshotter := NewSnapshotter(widgets, NewFileStore(dir), 2)
+
+	event := newEvent(3)
+	require.NoError(t, snapshotter.Attach(context.Background(), event))
+
+	metrics := widgets.widget["metrics"].([]any)
+	require.Len(t, metrics, 3, "alarm metric plus the top 2 resources")
+	assert.Equal(t, []any{"AWS/EC2", "CPUUtilization", map[string]any{"label": "cpu/high"}}, metrics[0])
+	assert.Equal(t, []any{"AWS/EC2", "CPUUtilization", "InstanceId", "i-a"}, metrics[1])
+	assert.Equal(t, "2025-10-02T03:00:00Z", widgets.widget["start"])
+	assert.Equal(t, "2025-10-02T06:00:00Z", widgets.widget["end"])
+	assert.Equal(t, map[string]any{
+		"horizontal": []any{map[string]any{"label": "Threshold", "value": 80.0}},
+	}, widgets.widget["annotations"])
+
+	u, err := url.Parse(event.GraphURL)
+	require.NoError(t, err)
+	assert.Equal(t, "file", u.Scheme)
+
+	data, err := os.ReadFile(u.Path)
+	require.NoError(t, err)
+	assert.Equal(t, png, data)
+	assert.Contains(t, u.Path, "111111111111/cpu%2Fhigh/20251002T060000Z.png")
+}
+
+func TestAttach_NoViolations(t *testing.T) {
+	widgets := &fakeWidgets{}
+	snapshotter := NewSnapshotter(widgets, NewFileStore(t.TempDir()), DefaultTopN)
+
+	event := newEvent(0)
+	require.NoError(t, snapshotter.Attach(context.Background(), event))
+	assert.Nil(t, widgets.widget)
+	assert.Empty(t, event.GraphURL)
+}
+
+// fakeS3 accepts every object and records the expiry URLs are presigned with.
+type fakeS3 struct {
+	expires time.Duration
+}
+
+func (f *fakeS3) PutObject(context.Context, *s3.PutObjectInput, ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) PresignGetObject(
+	_ context.Context,
+	input *s3.GetObjectInput,
+	optFns ...func(*s3.PresignOptions),
+) (*v4.PresignedHTTPRequest, error) {
+	var opts s3.PresignOptions
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	f.expires = opts.Expires
+	return &v4.PresignedHTTPRequest{URL: "https://bucket.s3.amazonaws.com/" + aws.ToString(input.Key)}, nil
+}
+
+func TestS3Store_PresignExpiry(t *testing.T) {
+	tests := []struct {
+		name  string
+		creds aws.CredentialsProvider
+		want  time.Duration
+	}{
+		{name: "no credentials", want: time.Hour},
+		{
+			name: "static credentials",
+			creds: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+				return aws.Credentials{AccessKeyID: "AKID"}, nil
+			}),
+			want: time.Hour,
+		},
+		{
+			name: "session outlasting the expiry",
+			creds: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+				return aws.Credentials{CanExpire: true, Expires: time.Now().Add(3 * time.Hour)}, nil
+			}),
+			want: time.Hour,
+		},
+		{
+			name: "session expiring sooner",
+			creds: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+				return aws.Credentials{CanExpire: true, Expires: time.Now().Add(30 * time.Minute)}, nil
+			}),
+			want: 29 * time.Minute,
+		},
+		{
+			name: "session about to expire",
+			creds: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+				return aws.Credentials{CanExpire: true, Expires: time.Now().Add(30 * time.Second)}, nil
+			}),
+			want: time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeS3{}
+			store := NewS3Store(client, client, tt.creds, "bucket", "snapshots/", time.Hour)
+
+			url, err := store.Put(context.Background(), "cpu-high.png", png, "image/png")
+			require.NoError(t, err)
+			assert.Equal(t, "https://bucket.s3.amazonaws.com/snapshots/cpu-high.png", url)
+			assert.InDelta(t, tt.want, client.expires, float64(time.Second))
+		})
+	}
+}
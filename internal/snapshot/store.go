@@ -0,0 +1,138 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Store persists snapshot images and returns a URL they can be fetched from.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) (string, error)
+}
+
+// S3API defines the S3 operations required by S3Store.
+type S3API interface {
+	PutObject(
+		ctx context.Context,
+		input *s3.PutObjectInput,
+		optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// PresignAPI defines the S3 presigning operations required by S3Store.
+type PresignAPI interface {
+	PresignGetObject(
+		ctx context.Context,
+		input *s3.GetObjectInput,
+		optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// presignExpiryMargin is how long before the signing credentials expire presigned URLs expire at
+// the latest, and the shortest validity they are presigned with.
+const presignExpiryMargin = time.Minute
+
+// S3Store stores snapshots in an S3 bucket and hands out presigned GET URLs.
+type S3Store struct {
+	client  S3API
+	presign PresignAPI
+	creds   aws.CredentialsProvider
+	bucket  string
+	prefix  string
+	expires time.Duration
+}
+
+// NewS3Store creates an S3Store writing objects under prefix in bucket. Presigned URLs are valid
+// for expires, but stop working along with the session that signed them: when creds, those the
+// presign client signs with, can expire, URLs are presigned to expire before they do. A nil creds
+// presigns for expires.
+func NewS3Store(
+	client S3API,
+	presign PresignAPI,
+	creds aws.CredentialsProvider,
+	bucket, prefix string,
+	expires time.Duration,
+) *S3Store {
+	return &S3Store{
+		client:  client,
+		presign: presign,
+		creds:   creds,
+		bucket:  bucket,
+		prefix:  prefix,
+		expires: expires,
+	}
+}
+
+// Put uploads the image and returns a presigned URL to it.
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	key = s.prefix + key
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot put object %q to bucket %q: %w", key, s.bucket, err)
+	}
+
+	req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(s.presignExpiry(ctx)))
+	if err != nil {
+		return "", fmt.Errorf("cannot presign object %q: %w", key, err)
+	}
+
+	return req.URL, nil
+}
+
+// presignExpiry returns the validity of a URL presigned now: expires, capped to end
+// presignExpiryMargin before the signing credentials expire.
+func (s *S3Store) presignExpiry(ctx context.Context) time.Duration {
+	if s.creds == nil {
+		return s.expires
+	}
+
+	creds, err := s.creds.Retrieve(ctx)
+	if err != nil || !creds.CanExpire {
+		return s.expires
+	}
+
+	remaining := time.Until(creds.Expires) - presignExpiryMargin
+
+	return max(min(s.expires, remaining), presignExpiryMargin)
+}
+
+// FileStore stores snapshots in a local directory. It stands in for S3 in tests and local runs.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a FileStore writing under dir.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// Put writes the image to disk and returns a file URL to it.
+func (s *FileStore) Put(_ context.Context, key string, data []byte, _ string) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("cannot create snapshot directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("cannot write snapshot %q: %w", path, err)
+	}
+
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(), nil
+}
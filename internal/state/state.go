@@ -0,0 +1,362 @@
+// Package state remembers the violating resources of alarms across invocations, so that enriched
+// events can tell new violations from ongoing and resolved ones.
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+var tracer = otel.Tracer("github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/state")
+
+// maxSaveAttempts bounds how many times the violations of an alarm are classified again and saved
+// when other invocations keep saving them concurrently.
+const maxSaveAttempts = 3
+
+// Resource is a violating resource as remembered between invocations.
+type Resource struct {
+	// Alarm names the child alarm a resource violates among the children of a composite alarm.
+	Alarm      string            `json:"alarm,omitempty"`
+	Dimensions map[string]string `json:"dimensions"`
+	FirstSeen  time.Time         `json:"firstSeen"`
+	LastSeen   time.Time         `json:"lastSeen"`
+}
+
+// Tracker classifies the violating resources of enriched events against those of the previous
+// event of the same alarm and records them for the next one.
+type Tracker struct {
+	store Store
+}
+
+// NewTracker creates a Tracker remembering violations in store.
+func NewTracker(store Store) *Tracker {
+	return &Tracker{store: store}
+}
+
+// Update is the violation state an event leaves behind: the new set of violating resources of
+// its alarm, along with the version of the set it replaces. It is saved with Tracker.Save once the
+// event was published, so that an event that fails to publish and is retried is classified the
+// same way again.
+type Update struct {
+	key       string
+	resources map[string]Resource
+	version   int64
+	// reclassify classifies the violations of the event again against those saved concurrently.
+	reclassify func(previous map[string]Resource) map[string]Resource
+}
+
+// Track sets the status and first-seen time of the violating metrics of an event and lists the
+// resources it resolved. Alarms in ALARM state are compared against their previous violations;
+// for composite alarms, those of each metric alarm among their children, recorded along with the
+// composite alarm apart from the children's own violations. Alarms back in OK state resolve all
+// of them, even when the event is a fallback for an alarm whose enrichment failed. Other states
+// leave the recorded violations untouched. The violations the event leaves behind are returned to
+// be saved, and are nil when there are none to record.
+//
+// Resources left out of an event by the top-N cap, or possibly left out because some resources
+// could not be evaluated, are not known to have stopped violating, so they are carried over
+// rather than resolved. So are the resources of child alarms no longer in ALARM state while their
+// composite alarm still is.
+func (t *Tracker) Track(ctx context.Context, event *events.EnrichedEvent) (*Update, error) {
+	ctx, span := tracer.Start(ctx, "state.track")
+	defer span.End()
+	span.SetAttributes(attribute.String("alarm.name", event.AlarmName()))
+
+	if event.AlarmName() == "" {
+		return nil, nil
+	}
+
+	key := alarmKey(event)
+	at := event.Timestamp
+
+	switch {
+	case event.StateValue() == types.StateValueOk:
+		update, resolved, err := t.track(ctx, key, at, nil, true)
+		if err != nil {
+			return nil, err
+		}
+		event.ResolvedResources = resolved
+
+		if event.Recovery != nil {
+			markResolved(event.Recovery.ResolvedMetrics, resolved)
+		}
+
+		return update, nil
+	case event.EnrichmentFailed():
+		// A fallback event says nothing about the resources of an alarm still violating.
+		return nil, nil
+	case event.Alarm != nil && event.StateValue() == types.StateValueAlarm:
+		update, resolved, err := t.track(ctx, key, at,
+			event.ViolatingMetrics, event.OmittedViolatingMetrics == 0 && len(event.EnrichmentErrors) == 0)
+		if err != nil {
+			return nil, err
+		}
+		event.ResolvedResources = resolved
+
+		return update, nil
+	case event.CompositeAlarm != nil && event.StateValue() == types.StateValueAlarm:
+		return t.trackChildren(ctx, key, at, metricChildren(event.ChildAlarms))
+	default:
+		return nil, nil
+	}
+}
+
+// Save records the violations an event left behind. A nil update saves nothing. When another
+// invocation saved the violations of the alarm in the meantime, they are classified again against
+// what it saved, so that neither update is lost; the published event is left as it was.
+func (t *Tracker) Save(ctx context.Context, update *Update) error {
+	if update == nil {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, "state.save")
+	defer span.End()
+
+	resources, version := update.resources, update.version
+
+	for attempt := 1; ; attempt++ {
+		err := t.store.Save(ctx, update.key, resources, version)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrConflict) || attempt == maxSaveAttempts {
+			return fmt.Errorf("cannot save violation state of %q: %w", update.key, err)
+		}
+
+		previous, current, err := t.store.Load(ctx, update.key)
+		if err != nil {
+			return fmt.Errorf("cannot load violation state of %q: %w", update.key, err)
+		}
+
+		resources, version = update.reclassify(previous), current
+	}
+}
+
+// track classifies the violating metrics of a metric alarm against its recorded violations and
+// returns the new set along with the resolved resources.
+func (t *Tracker) track(
+	ctx context.Context,
+	key string,
+	at time.Time,
+	metrics []events.ViolatingMetric,
+	complete bool,
+) (*Update, []events.ResolvedResource, error) {
+	previous, version, err := t.store.Load(ctx, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot load violation state of %q: %w", key, err)
+	}
+
+	current, resolved := classify(previous, at, metrics, complete)
+
+	metrics = slices.Clone(metrics)
+	update := &Update{
+		key:       key,
+		resources: current,
+		version:   version,
+		reclassify: func(previous map[string]Resource) map[string]Resource {
+			current, _ := classify(previous, at, slices.Clone(metrics), complete)
+			return current
+		},
+	}
+
+	return update, resolved, nil
+}
+
+// trackChildren classifies the violating metrics of the metric alarms among the children of a
+// composite alarm against the violations recorded for the composite alarm, setting the resources
+// each child resolved, and returns the new set.
+func (t *Tracker) trackChildren(
+	ctx context.Context,
+	key string,
+	at time.Time,
+	children []*events.ChildAlarm,
+) (*Update, error) {
+	previous, version, err := t.store.Load(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load violation state of %q: %w", key, err)
+	}
+
+	current := classifyChildren(previous, at, children, true)
+
+	// Classifying again must leave the published children as they are.
+	clones := make([]*events.ChildAlarm, len(children))
+	for i, child := range children {
+		clone := *child
+		clone.ViolatingMetrics = slices.Clone(child.ViolatingMetrics)
+		clones[i] = &clone
+	}
+
+	return &Update{
+		key:       key,
+		resources: current,
+		version:   version,
+		reclassify: func(previous map[string]Resource) map[string]Resource {
+			return classifyChildren(previous, at, clones, false)
+		},
+	}, nil
+}
+
+// classifyChildren classifies the violating metrics of each child alarm against the previous
+// violations of that child, and returns the new set of violations of all children, keyed by child
+// and resource. The previous violations of children not listed are carried over. The resources
+// each child resolved are set on it when setResolved is true.
+func classifyChildren(
+	previous map[string]Resource,
+	at time.Time,
+	children []*events.ChildAlarm,
+	setResolved bool,
+) map[string]Resource {
+	byChild := make(map[string]map[string]Resource)
+	for k, r := range previous {
+		if byChild[r.Alarm] == nil {
+			byChild[r.Alarm] = make(map[string]Resource)
+		}
+		byChild[r.Alarm][k] = r
+	}
+
+	current := make(map[string]Resource, len(previous))
+
+	for _, child := range children {
+		name := aws.ToString(child.Alarm.AlarmName)
+
+		resources, resolved := classify(rekey(byChild[name], ""), at, child.ViolatingMetrics,
+			child.OmittedViolatingMetrics == 0 && len(child.EnrichmentErrors) == 0)
+		delete(byChild, name)
+
+		maps.Copy(current, rekey(resources, name))
+		if setResolved {
+			child.ResolvedResources = resolved
+		}
+	}
+
+	for _, resources := range byChild {
+		maps.Copy(current, resources)
+	}
+
+	return current
+}
+
+// rekey keys resources by the child alarm they violate, if any, and their dimensions.
+func rekey(resources map[string]Resource, alarm string) map[string]Resource {
+	keyed := make(map[string]Resource, len(resources))
+	for _, r := range resources {
+		r.Alarm = alarm
+		key := resourceKey(r.Dimensions)
+		if alarm != "" {
+			key = alarm + "#" + key
+		}
+		keyed[key] = r
+	}
+	return keyed
+}
+
+// metricChildren returns the metric alarms among the children of a composite alarm, nested
+// composite alarms included, leaving out those that could not be enriched at all.
+func metricChildren(children []events.ChildAlarm) []*events.ChildAlarm {
+	var metrics []*events.ChildAlarm
+	for i := range children {
+		child := &children[i]
+		switch {
+		case child.CompositeAlarm != nil:
+			metrics = append(metrics, metricChildren(child.ChildAlarms)...)
+		case child.Alarm != nil && !child.EnrichmentFailed():
+			metrics = append(metrics, child)
+		}
+	}
+	return metrics
+}
+
+// classify sets the status and first-seen time of violating metrics from the previous violations
+// of their alarm, and returns the new set of violations along with the resolved resources, the
+// longest violating first. Previous resources missing from metrics are resolved only when metrics
+// is complete.
+func classify(
+	previous map[string]Resource,
+	at time.Time,
+	metrics []events.ViolatingMetric,
+	complete bool,
+) (map[string]Resource, []events.ResolvedResource) {
+	current := make(map[string]Resource, len(metrics))
+
+	for i := range metrics {
+		vm := &metrics[i]
+		k := resourceKey(vm.Dimensions)
+
+		vm.Status = events.ViolationNew
+		vm.FirstSeen = at
+		if p, ok := previous[k]; ok {
+			vm.Status = events.ViolationOngoing
+			vm.FirstSeen = p.FirstSeen
+		}
+
+		current[k] = Resource{Dimensions: vm.Dimensions, FirstSeen: vm.FirstSeen, LastSeen: at}
+	}
+
+	var resolved []events.ResolvedResource
+
+	for _, k := range slices.Sorted(maps.Keys(previous)) {
+		if _, ok := current[k]; ok {
+			continue
+		}
+
+		p := previous[k]
+		if !complete {
+			current[k] = p
+			continue
+		}
+
+		resolved = append(resolved, events.ResolvedResource{
+			Dimensions: p.Dimensions,
+			FirstSeen:  p.FirstSeen,
+			LastSeen:   p.LastSeen,
+		})
+	}
+
+	slices.SortStableFunc(resolved, func(a, b events.ResolvedResource) int {
+		return a.FirstSeen.Compare(b.FirstSeen)
+	})
+
+	return current, resolved
+}
+
+// markResolved sets the status and first-seen time of the resolved metrics of a recovery.
+func markResolved(metrics []events.ViolatingMetric, resolved []events.ResolvedResource) {
+	firstSeen := make(map[string]time.Time, len(resolved))
+	for _, r := range resolved {
+		firstSeen[resourceKey(r.Dimensions)] = r.FirstSeen
+	}
+
+	for i := range metrics {
+		metrics[i].Status = events.ViolationResolved
+		metrics[i].FirstSeen = firstSeen[resourceKey(metrics[i].Dimensions)]
+	}
+}
+
+// alarmKey identifies the alarm of an event across accounts and regions.
+func alarmKey(event *events.EnrichedEvent) string {
+	return event.AccountID + "/" + event.Region + "/" + event.AlarmName()
+}
+
+// resourceKey renders dimensions in a canonical form.
+func resourceKey(dims map[string]string) string {
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(dims)) {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(dims[name])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
@@ -0,0 +1,454 @@
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+var t0 = time.Date(2025, 10, 2, 6, 0, 0, 0, time.UTC)
+
+func newEvent(at time.Time, state types.StateValue, instances ...string) *events.EnrichedEvent {
+	event := &events.EnrichedEvent{
+		AccountID: "111111111111",
+		Region:    "eu-north-1",
+		Timestamp: at,
+		Alarm: &types.MetricAlarm{
+			AlarmName:  aws.String("cpu-high"),
+			StateValue: state,
+		},
+		ViolatingMetrics: []events.ViolatingMetric{},
+	}
+
+	for _, id := range instances {
+		event.ViolatingMetrics = append(event.ViolatingMetrics, events.ViolatingMetric{
+			Dimensions: map[string]string{"InstanceId": id},
+		})
+	}
+
+	return event
+}
+
+// track classifies an event and saves its violations, as if it was published.
+func track(t *testing.T, tracker *Tracker, event *events.EnrichedEvent) {
+	t.Helper()
+
+	update, err := tracker.Track(context.Background(), event)
+	require.NoError(t, err)
+	require.NoError(t, tracker.Save(context.Background(), update))
+}
+
+func TestTrack(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore())
+
+	first := newEvent(t0, types.StateValueAlarm, "i-a", "i-b")
+	track(t, tracker, first)
+	for _, vm := range first.ViolatingMetrics {
+		assert.Equal(t, events.ViolationNew, vm.Status)
+		assert.Equal(t, t0, vm.FirstSeen)
+	}
+	assert.Empty(t, first.ResolvedResources)
+
+	second := newEvent(t0.Add(2*time.Hour), types.StateValueAlarm, "i-b", "i-c")
+	track(t, tracker, second)
+	assert.Equal(t, events.ViolationOngoing, second.ViolatingMetrics[0].Status)
+	assert.Equal(t, t0, second.ViolatingMetrics[0].FirstSeen, "first seen is kept while ongoing")
+	assert.Equal(t, events.ViolationNew, second.ViolatingMetrics[1].Status)
+	assert.Equal(t, []events.ResolvedResource{
+		{Dimensions: map[string]string{"InstanceId": "i-a"}, FirstSeen: t0, LastSeen: t0},
+	}, second.ResolvedResources)
+
+	recovered := newEvent(t0.Add(3*time.Hour), types.StateValueOk)
+	recovered.Recovery = &events.Recovery{
+		ResolvedMetrics: []events.ViolatingMetric{{Dimensions: map[string]string{"InstanceId": "i-b"}}},
+	}
+	track(t, tracker, recovered)
+	require.Len(t, recovered.ResolvedResources, 2)
+	assert.Equal(t, "i-b", recovered.ResolvedResources[0].Dimensions["InstanceId"], "longest violating first")
+	assert.Equal(t, events.ViolationResolved, recovered.Recovery.ResolvedMetrics[0].Status)
+	assert.Equal(t, t0, recovered.Recovery.ResolvedMetrics[0].FirstSeen)
+
+	again := newEvent(t0.Add(4*time.Hour), types.StateValueAlarm, "i-b")
+	track(t, tracker, again)
+	assert.Equal(t, events.ViolationNew, again.ViolatingMetrics[0].Status, "recovery forgets violations")
+}
+
+func TestTrack_TruncatedEventKeepsUnlistedResources(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore())
+
+	track(t, tracker, newEvent(t0, types.StateValueAlarm, "i-a", "i-b"))
+
+	truncated := newEvent(t0.Add(time.Hour), types.StateValueAlarm, "i-b")
+	truncated.OmittedViolatingMetrics = 1
+	track(t, tracker, truncated)
+	assert.Empty(t, truncated.ResolvedResources)
+
+	complete := newEvent(t0.Add(2*time.Hour), types.StateValueAlarm, "i-a")
+	track(t, tracker, complete)
+	assert.Equal(t, events.ViolationOngoing, complete.ViolatingMetrics[0].Status)
+	assert.Equal(t, t0, complete.ViolatingMetrics[0].FirstSeen)
+}
+
+func TestTrack_IgnoresInsufficientData(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	tracker := NewTracker(store)
+
+	track(t, tracker, newEvent(t0, types.StateValueAlarm, "i-a"))
+	track(t, tracker, newEvent(t0.Add(time.Hour), types.StateValueInsufficientData))
+
+	resources, _, err := store.Load(ctx, "111111111111/eu-north-1/cpu-high")
+	require.NoError(t, err)
+	assert.Len(t, resources, 1)
+}
+
+func TestTrack_StateChangeStateOverridesDescribedState(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore())
+	track(t, tracker, newEvent(t0, types.StateValueAlarm, "i-a"))
+
+	// A retried ALARM event, enriched after the alarm went back to OK.
+	retried := newEvent(t0.Add(time.Minute), types.StateValueOk, "i-a")
+	retried.StateChange = &events.AlarmStateChange{State: events.AlarmState{Value: types.StateValueAlarm}}
+	track(t, tracker, retried)
+	assert.Equal(t, events.ViolationOngoing, retried.ViolatingMetrics[0].Status)
+	assert.Empty(t, retried.ResolvedResources)
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(t.TempDir())
+	key := "111111111111/eu-north-1/cpu/high"
+
+	resources, version, err := store.Load(ctx, key)
+	require.NoError(t, err)
+	assert.Empty(t, resources)
+	assert.Zero(t, version)
+
+	want := map[string]Resource{
+		"InstanceId=i-a,": {Dimensions: map[string]string{"InstanceId": "i-a"}, FirstSeen: t0, LastSeen: t0},
+	}
+	require.NoError(t, store.Save(ctx, key, want, 0))
+	require.ErrorIs(t, store.Save(ctx, key, want, 0), ErrConflict)
+
+	resources, version, err = store.Load(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, want, resources)
+	assert.Equal(t, int64(1), version)
+
+	require.NoError(t, store.Save(ctx, key, nil, version))
+	resources, _, err = store.Load(ctx, key)
+	require.NoError(t, err)
+	assert.Empty(t, resources)
+}
+
+// fakeDynamoDB keeps items in memory, keyed by their alarmKey attribute.
+type fakeDynamoDB struct {
+	items map[string]*dynamodb.PutItemInput
+}
+
+func (f *fakeDynamoDB) GetItem(
+	_ context.Context,
+	input *dynamodb.GetItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.GetItemOutput, error) {
+	put, ok := f.items[keyOf(input.Key)]
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: put.Item}, nil
+}
+
+func (f *fakeDynamoDB) PutItem(
+	_ context.Context,
+	input *dynamodb.PutItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.PutItemOutput, error) {
+	if !f.versionMatches(keyOf(input.Item), input.ExpressionAttributeValues) {
+		return nil, &dynamodbtypes.ConditionalCheckFailedException{}
+	}
+	f.items[keyOf(input.Item)] = input
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(
+	_ context.Context,
+	input *dynamodb.DeleteItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.DeleteItemOutput, error) {
+	if !f.versionMatches(keyOf(input.Key), input.ExpressionAttributeValues) {
+		return nil, &dynamodbtypes.ConditionalCheckFailedException{}
+	}
+	delete(f.items, keyOf(input.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// versionMatches evaluates the version condition of a write: the stored version equals :version,
+// or there is none when :version is not given.
+func (f *fakeDynamoDB) versionMatches(key string, values map[string]dynamodbtypes.AttributeValue) bool {
+	var stored dynamodbtypes.AttributeValue
+	if put, ok := f.items[key]; ok {
+		stored = put.Item[attrVersion]
+	}
+
+	want, ok := values[":version"]
+	if !ok {
+		return stored == nil
+	}
+
+	return stored != nil && stored.(*dynamodbtypes.AttributeValueMemberN).Value == want.(*dynamodbtypes.AttributeValueMemberN).Value
+}
+
+func keyOf(item map[string]dynamodbtypes.AttributeValue) string {
+	return item[attrAlarmKey].(*dynamodbtypes.AttributeValueMemberS).Value
+}
+
+func TestDynamoStore(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeDynamoDB{items: make(map[string]*dynamodb.PutItemInput)}
+	store := NewDynamoStore(client, "alarm-state", time.Hour)
+	key := "111111111111/eu-north-1/cpu-high"
+
+	resources, version, err := store.Load(ctx, key)
+	require.NoError(t, err)
+	assert.Empty(t, resources)
+	assert.Zero(t, version)
+
+	want := map[string]Resource{
+		"InstanceId=i-a,": {Dimensions: map[string]string{"InstanceId": "i-a"}, FirstSeen: t0, LastSeen: t0},
+	}
+	require.NoError(t, store.Save(ctx, key, want, 0))
+	require.ErrorIs(t, store.Save(ctx, key, want, 0), ErrConflict)
+
+	put := client.items[key]
+	require.NotNil(t, put)
+	assert.Equal(t, "alarm-state", aws.ToString(put.TableName))
+	assert.Contains(t, put.Item, attrExpiresAt)
+
+	resources, version, err = store.Load(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, want, resources)
+	assert.Equal(t, int64(1), version)
+
+	require.NoError(t, store.Save(ctx, key, want, version))
+	require.ErrorIs(t, store.Save(ctx, key, nil, version), ErrConflict)
+	require.NoError(t, store.Save(ctx, key, nil, version+1))
+	assert.Empty(t, client.items)
+}
+
+func TestTrack_PartialEventKeepsUnlistedResources(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore())
+
+	track(t, tracker, newEvent(t0, types.StateValueAlarm, "i-a", "i-b"))
+
+	partial := newEvent(t0.Add(time.Hour), types.StateValueAlarm, "i-b")
+	partial.Partial = true
+	partial.EnrichmentErrors = []events.EnrichmentError{{Reason: events.EnrichmentBatchFailed, Metrics: 500}}
+	track(t, tracker, partial)
+	assert.Empty(t, partial.ResolvedResources)
+}
+
+func TestTrack_IgnoresFallbackEvents(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	tracker := NewTracker(store)
+
+	track(t, tracker, newEvent(t0, types.StateValueAlarm, "i-a"))
+
+	fallback := newEvent(t0.Add(time.Hour), types.StateValueAlarm)
+	fallback.EnrichmentFailure = "throttled"
+	track(t, tracker, fallback)
+	assert.Empty(t, fallback.ResolvedResources)
+
+	resources, _, err := store.Load(ctx, "111111111111/eu-north-1/cpu-high")
+	require.NoError(t, err)
+	assert.Len(t, resources, 1)
+}
+
+func TestTrack_UnsavedEventIsClassifiedAgain(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewTracker(NewMemoryStore())
+
+	track(t, tracker, newEvent(t0, types.StateValueAlarm, "i-a"))
+
+	// The event failed to publish, so its violations are not saved and its retry resolves i-a too.
+	unpublished := newEvent(t0.Add(time.Hour), types.StateValueAlarm, "i-b")
+	_, err := tracker.Track(ctx, unpublished)
+	require.NoError(t, err)
+	require.Len(t, unpublished.ResolvedResources, 1)
+
+	retry := newEvent(t0.Add(time.Hour), types.StateValueAlarm, "i-b")
+	track(t, tracker, retry)
+	assert.Equal(t, unpublished.ResolvedResources, retry.ResolvedResources)
+	assert.Equal(t, events.ViolationNew, retry.ViolatingMetrics[0].Status)
+}
+
+func TestTrack_ConcurrentSavesAreNotLost(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	tracker := NewTracker(store)
+
+	track(t, tracker, newEvent(t0, types.StateValueAlarm, "i-a"))
+
+	// Two invocations classify against the same state; the second to save is truncated, so it
+	// keeps what the first one saved rather than overwriting it.
+	first := newEvent(t0.Add(time.Hour), types.StateValueAlarm, "i-a", "i-b")
+	firstUpdate, err := tracker.Track(ctx, first)
+	require.NoError(t, err)
+
+	second := newEvent(t0.Add(time.Hour), types.StateValueAlarm, "i-c")
+	second.OmittedViolatingMetrics = 1
+	secondUpdate, err := tracker.Track(ctx, second)
+	require.NoError(t, err)
+
+	require.NoError(t, tracker.Save(ctx, firstUpdate))
+	require.NoError(t, tracker.Save(ctx, secondUpdate))
+
+	resources, version, err := store.Load(ctx, "111111111111/eu-north-1/cpu-high")
+	require.NoError(t, err)
+	assert.Len(t, resources, 3)
+	assert.Equal(t, int64(3), version)
+	assert.Equal(t, t0, resources["InstanceId=i-a,"].FirstSeen)
+}
+
+func TestTrack_CompositeChildrenKeptApartFromChildAlarms(t *testing.T) {
+	child := newEvent(t0, types.StateValueAlarm, "i-a")
+	composite := &events.EnrichedEvent{
+		AccountID: child.AccountID,
+		Region:    child.Region,
+		Timestamp: t0,
+		CompositeAlarm: &types.CompositeAlarm{
+			AlarmName:  aws.String("service-down"),
+			StateValue: types.StateValueAlarm,
+		},
+		ChildAlarms: []events.ChildAlarm{{Alarm: child.Alarm, ViolatingMetrics: child.ViolatingMetrics}},
+	}
+
+	store := NewMemoryStore()
+	tracker := NewTracker(store)
+	track(t, tracker, composite)
+
+	own := newEvent(t0.Add(time.Hour), types.StateValueAlarm, "i-b")
+	track(t, tracker, own)
+	assert.Empty(t, own.ResolvedResources, "the composite's view of the child is not resolved")
+	assert.Equal(t, events.ViolationNew, own.ViolatingMetrics[0].Status)
+
+	resources, _, err := store.Load(context.Background(), "111111111111/eu-north-1/service-down")
+	require.NoError(t, err)
+	require.Contains(t, resources, "cpu-high#InstanceId=i-a,")
+	assert.Equal(t, "cpu-high", resources["cpu-high#InstanceId=i-a,"].Alarm)
+}
+
+func newCompositeEvent(at time.Time, state types.StateValue, children ...events.ChildAlarm) *events.EnrichedEvent {
+	return &events.EnrichedEvent{
+		AccountID: "111111111111",
+		Region:    "eu-north-1",
+		Timestamp: at,
+		CompositeAlarm: &types.CompositeAlarm{
+			AlarmName:  aws.String("service-down"),
+			StateValue: state,
+		},
+		ViolatingMetrics: []events.ViolatingMetric{},
+		ChildAlarms:      children,
+	}
+}
+
+func newChild(name string, instances ...string) events.ChildAlarm {
+	child := events.ChildAlarm{Alarm: &types.MetricAlarm{AlarmName: aws.String(name), StateValue: types.StateValueAlarm}}
+	for _, id := range instances {
+		child.ViolatingMetrics = append(child.ViolatingMetrics, events.ViolatingMetric{
+			Dimensions: map[string]string{"InstanceId": id},
+		})
+	}
+	return child
+}
+
+func TestTrack_CompositeChildren(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore())
+
+	track(t, tracker, newCompositeEvent(t0, types.StateValueAlarm, newChild("cpu-high", "i-a"), newChild("disk-full", "i-a")))
+
+	// disk-full is no longer in ALARM state, so its resources are carried over.
+	second := newCompositeEvent(t0.Add(time.Hour), types.StateValueAlarm, newChild("cpu-high", "i-b"))
+	track(t, tracker, second)
+	assert.Equal(t, events.ViolationNew, second.ChildAlarms[0].ViolatingMetrics[0].Status)
+	assert.Equal(t, []events.ResolvedResource{
+		{Dimensions: map[string]string{"InstanceId": "i-a"}, FirstSeen: t0, LastSeen: t0},
+	}, second.ChildAlarms[0].ResolvedResources)
+
+	third := newCompositeEvent(t0.Add(2*time.Hour), types.StateValueAlarm, newChild("disk-full", "i-a"))
+	track(t, tracker, third)
+	assert.Equal(t, events.ViolationOngoing, third.ChildAlarms[0].ViolatingMetrics[0].Status)
+	assert.Equal(t, t0, third.ChildAlarms[0].ViolatingMetrics[0].FirstSeen)
+}
+
+func TestTrack_CompositeOKResolvesChildren(t *testing.T) {
+	store := NewMemoryStore()
+	tracker := NewTracker(store)
+
+	nested := events.ChildAlarm{
+		CompositeAlarm: &types.CompositeAlarm{AlarmName: aws.String("api-down"), StateValue: types.StateValueAlarm},
+		ChildAlarms:    []events.ChildAlarm{newChild("disk-full", "i-b")},
+	}
+	track(t, tracker, newCompositeEvent(t0, types.StateValueAlarm, newChild("cpu-high", "i-a"), nested))
+
+	recovered := newCompositeEvent(t0.Add(time.Hour), types.StateValueOk)
+	track(t, tracker, recovered)
+	assert.Len(t, recovered.ResolvedResources, 2)
+
+	resources, _, err := store.Load(context.Background(), "111111111111/eu-north-1/service-down")
+	require.NoError(t, err)
+	assert.Empty(t, resources)
+
+	// The next incident starts afresh.
+	again := newCompositeEvent(t0.Add(2*time.Hour), types.StateValueAlarm, newChild("cpu-high", "i-a"))
+	track(t, tracker, again)
+	assert.Equal(t, events.ViolationNew, again.ChildAlarms[0].ViolatingMetrics[0].Status)
+	assert.Equal(t, t0.Add(2*time.Hour), again.ChildAlarms[0].ViolatingMetrics[0].FirstSeen)
+}
+
+func TestTrack_FallbackOKResolvesResources(t *testing.T) {
+	store := NewMemoryStore()
+	tracker := NewTracker(store)
+
+	track(t, tracker, newEvent(t0, types.StateValueAlarm, "i-a"))
+
+	fallback := newEvent(t0.Add(time.Hour), types.StateValueOk)
+	fallback.EnrichmentFailure = "throttled"
+	track(t, tracker, fallback)
+	assert.Len(t, fallback.ResolvedResources, 1)
+
+	resources, _, err := store.Load(context.Background(), "111111111111/eu-north-1/cpu-high")
+	require.NoError(t, err)
+	assert.Empty(t, resources)
+}
+
+func TestTrack_ConcurrentCompositeSavesAreNotLost(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	tracker := NewTracker(store)
+
+	first := newCompositeEvent(t0, types.StateValueAlarm, newChild("cpu-high", "i-a"))
+	firstUpdate, err := tracker.Track(ctx, first)
+	require.NoError(t, err)
+
+	second := newCompositeEvent(t0, types.StateValueAlarm, newChild("disk-full", "i-b"))
+	secondUpdate, err := tracker.Track(ctx, second)
+	require.NoError(t, err)
+
+	require.NoError(t, tracker.Save(ctx, firstUpdate))
+	require.NoError(t, tracker.Save(ctx, secondUpdate))
+
+	resources, _, err := store.Load(ctx, "111111111111/eu-north-1/service-down")
+	require.NoError(t, err)
+	assert.Len(t, resources, 2)
+	assert.Equal(t, events.ViolationNew, second.ChildAlarms[0].ViolatingMetrics[0].Status)
+}
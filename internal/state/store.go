@@ -0,0 +1,303 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Store persists the violating resources of alarms, keyed by resource dimensions. Every save of
+// an alarm bumps its version, so that concurrent invocations don't overwrite each other's updates.
+type Store interface {
+	// Load returns the recorded resources of an alarm and their version; none and version 0 when
+	// nothing is recorded.
+	Load(ctx context.Context, key string) (map[string]Resource, int64, error)
+	// Save replaces the recorded resources of an alarm if they are still at version, and fails
+	// with ErrConflict otherwise. Saving none forgets the alarm.
+	Save(ctx context.Context, key string, resources map[string]Resource, version int64) error
+}
+
+// ErrConflict is returned by Store.Save when the resources of an alarm were saved since they were
+// loaded.
+var ErrConflict = errors.New("violation state changed concurrently")
+
+// DynamoDBAPI defines the DynamoDB operations required by DynamoStore.
+type DynamoDBAPI interface {
+	GetItem(
+		ctx context.Context,
+		input *dynamodb.GetItemInput,
+		optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+
+	PutItem(
+		ctx context.Context,
+		input *dynamodb.PutItemInput,
+		optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+
+	DeleteItem(
+		ctx context.Context,
+		input *dynamodb.DeleteItemInput,
+		optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DynamoDB item attributes. The table's partition key is a string named alarmKey; expiresAt can
+// be enabled as the table's TTL attribute.
+const (
+	attrAlarmKey  = "alarmKey"
+	attrResources = "resources"
+	attrVersion   = "version"
+	attrUpdatedAt = "updatedAt"
+	attrExpiresAt = "expiresAt"
+)
+
+// DynamoStore stores violations in a DynamoDB table, one item per alarm holding its resources as JSON.
+type DynamoStore struct {
+	client DynamoDBAPI
+	table  string
+	ttl    time.Duration
+}
+
+// NewDynamoStore creates a DynamoStore writing to table. Items expire ttl after they were last
+// written when the table has TTL enabled on expiresAt; a ttl of 0 writes no expiry.
+func NewDynamoStore(client DynamoDBAPI, table string, ttl time.Duration) *DynamoStore {
+	return &DynamoStore{
+		client: client,
+		table:  table,
+		ttl:    ttl,
+	}
+}
+
+// Load reads the item of an alarm.
+func (s *DynamoStore) Load(ctx context.Context, key string) (map[string]Resource, int64, error) {
+	output, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]types.AttributeValue{attrAlarmKey: &types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot get item from table %q: %w", s.table, err)
+	}
+
+	var version int64
+	if attr, ok := output.Item[attrVersion].(*types.AttributeValueMemberN); ok {
+		version, err = strconv.ParseInt(attr.Value, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot parse version of %q: %w", key, err)
+		}
+	}
+
+	attr, ok := output.Item[attrResources].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, version, nil
+	}
+
+	var resources map[string]Resource
+	if err := json.Unmarshal([]byte(attr.Value), &resources); err != nil {
+		return nil, 0, fmt.Errorf("cannot unmarshal resources of %q: %w", key, err)
+	}
+
+	return resources, version, nil
+}
+
+// Save writes the item of an alarm, or deletes it when there are no resources, on condition that
+// the item is still at version. Items written before versions were recorded count as version 0.
+func (s *DynamoStore) Save(
+	ctx context.Context,
+	key string,
+	resources map[string]Resource,
+	version int64,
+) error {
+	itemKey := map[string]types.AttributeValue{attrAlarmKey: &types.AttributeValueMemberS{Value: key}}
+	condition, names, values := versionCondition(version)
+
+	if len(resources) == 0 {
+		if _, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:                 aws.String(s.table),
+			Key:                       itemKey,
+			ConditionExpression:       condition,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		}); err != nil {
+			return dynamoError(err, "cannot delete item from table %q", s.table)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(resources)
+	if err != nil {
+		return fmt.Errorf("cannot marshal resources of %q: %w", key, err)
+	}
+
+	now := time.Now()
+
+	item := map[string]types.AttributeValue{
+		attrAlarmKey:  itemKey[attrAlarmKey],
+		attrResources: &types.AttributeValueMemberS{Value: string(data)},
+		attrVersion:   &types.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)},
+		attrUpdatedAt: &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+	}
+	if s.ttl > 0 {
+		item[attrExpiresAt] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(s.ttl).Unix(), 10)}
+	}
+
+	if _, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(s.table),
+		Item:                      item,
+		ConditionExpression:       condition,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}); err != nil {
+		return dynamoError(err, "cannot put item to table %q", s.table)
+	}
+
+	return nil
+}
+
+// versionCondition renders the condition that an item is at version.
+func versionCondition(version int64) (*string, map[string]string, map[string]types.AttributeValue) {
+	names := map[string]string{"#version": attrVersion}
+
+	if version == 0 {
+		return aws.String("attribute_not_exists(#version)"), names, nil
+	}
+
+	return aws.String("#version = :version"), names, map[string]types.AttributeValue{
+		":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+	}
+}
+
+// dynamoError wraps the error of a conditional write, reporting failed conditions as ErrConflict.
+func dynamoError(err error, format string, args ...any) error {
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		err = ErrConflict
+	}
+	return fmt.Errorf(format+": %w", append(args, err)...)
+}
+
+// MemoryStore keeps violations in memory. It stands in for DynamoDB in tests.
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]storedState
+}
+
+// storedState is the recorded resources of an alarm along with their version.
+type storedState struct {
+	Version   int64               `json:"version"`
+	Resources map[string]Resource `json:"resources"`
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]storedState)}
+}
+
+// Load returns a copy of the recorded resources of an alarm.
+func (s *MemoryStore) Load(_ context.Context, key string) (map[string]Resource, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := s.items[key]
+
+	return maps.Clone(item.Resources), item.Version, nil
+}
+
+// Save records a copy of the resources of an alarm.
+func (s *MemoryStore) Save(_ context.Context, key string, resources map[string]Resource, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.items[key].Version != version {
+		return ErrConflict
+	}
+
+	if len(resources) == 0 {
+		delete(s.items, key)
+		return nil
+	}
+
+	s.items[key] = storedState{Version: version + 1, Resources: maps.Clone(resources)}
+
+	return nil
+}
+
+// FileStore keeps violations in a local directory, one JSON file per alarm. It stands in for
+// DynamoDB in local runs, and checks versions without guarding against concurrent processes.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a FileStore writing under dir.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// Load reads the file of an alarm.
+func (s *FileStore) Load(_ context.Context, key string) (map[string]Resource, int64, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot read violation state: %w", err)
+	}
+
+	var stored storedState
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, 0, fmt.Errorf("cannot unmarshal resources of %q: %w", key, err)
+	}
+
+	return stored.Resources, stored.Version, nil
+}
+
+// Save writes the file of an alarm, or removes it when there are no resources.
+func (s *FileStore) Save(ctx context.Context, key string, resources map[string]Resource, version int64) error {
+	_, current, err := s.Load(ctx, key)
+	if err != nil {
+		return err
+	}
+	if current != version {
+		return ErrConflict
+	}
+
+	path := s.path(key)
+
+	if len(resources) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("cannot remove violation state: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(storedState{Version: version + 1, Resources: resources})
+	if err != nil {
+		return fmt.Errorf("cannot marshal resources of %q: %w", key, err)
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("cannot create state directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("cannot write violation state %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// path names the file of an alarm after its escaped key.
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".json")
+}
@@ -0,0 +1,148 @@
+package tags
+
+import (
+	"slices"
+	"strings"
+)
+
+// Location is the account and region the resources behind a set of metrics live in.
+type Location struct {
+	Partition string
+	AccountID string
+	Region    string
+}
+
+// PartitionForRegion returns the AWS partition a region belongs to.
+func PartitionForRegion(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	default:
+		return "aws"
+	}
+}
+
+// resourceRule maps the dimensions of a metric to the ARN of the resource it describes.
+type resourceRule struct {
+	// namespaces restricts the rule to metrics of these namespaces; empty matches any namespace.
+	namespaces []string
+	// dimensions must all be present for the rule to apply.
+	dimensions []string
+	// arn builds the ARN from the dimension values, in the order of dimensions.
+	arn func(loc Location, values []string) string
+}
+
+// resourceRules are tried in order; more specific rules come first.
+var resourceRules = []resourceRule{
+	{
+		namespaces: []string{"AWS/ECS", "ECS/ContainerInsights"},
+		dimensions: []string{"ClusterName", "ServiceName"},
+		arn: func(loc Location, v []string) string {
+			return regional(loc, "ecs", "service/"+v[0]+"/"+v[1])
+		},
+	},
+	{
+		namespaces: []string{"AWS/ECS", "ECS/ContainerInsights"},
+		dimensions: []string{"ClusterName"},
+		arn:        func(loc Location, v []string) string { return regional(loc, "ecs", "cluster/"+v[0]) },
+	},
+	{
+		dimensions: []string{"TargetGroup"},
+		arn:        func(loc Location, v []string) string { return regional(loc, "elasticloadbalancing", v[0]) },
+	},
+	{
+		// LoadBalancer values look like "app/name/id" or "net/name/id".
+		dimensions: []string{"LoadBalancer"},
+		arn: func(loc Location, v []string) string {
+			return regional(loc, "elasticloadbalancing", "loadbalancer/"+v[0])
+		},
+	},
+	{
+		namespaces: []string{"AWS/ELB"},
+		dimensions: []string{"LoadBalancerName"},
+		arn: func(loc Location, v []string) string {
+			return regional(loc, "elasticloadbalancing", "loadbalancer/"+v[0])
+		},
+	},
+	{
+		dimensions: []string{"InstanceId"},
+		arn:        func(loc Location, v []string) string { return regional(loc, "ec2", "instance/"+v[0]) },
+	},
+	{
+		dimensions: []string{"DBInstanceIdentifier"},
+		arn:        func(loc Location, v []string) string { return regional(loc, "rds", "db:"+v[0]) },
+	},
+	{
+		dimensions: []string{"DBClusterIdentifier"},
+		arn:        func(loc Location, v []string) string { return regional(loc, "rds", "cluster:"+v[0]) },
+	},
+	{
+		dimensions: []string{"FunctionName"},
+		arn: func(loc Location, v []string) string {
+			// Resource-qualified metrics carry "name:alias" in FunctionName.
+			name, _, _ := strings.Cut(v[0], ":")
+			return regional(loc, "lambda", "function:"+name)
+		},
+	},
+	{
+		dimensions: []string{"QueueName"},
+		arn:        func(loc Location, v []string) string { return regional(loc, "sqs", v[0]) },
+	},
+	{
+		dimensions: []string{"TopicName"},
+		arn:        func(loc Location, v []string) string { return regional(loc, "sns", v[0]) },
+	},
+	{
+		dimensions: []string{"TableName"},
+		arn:        func(loc Location, v []string) string { return regional(loc, "dynamodb", "table/"+v[0]) },
+	},
+	{
+		dimensions: []string{"StreamName"},
+		arn:        func(loc Location, v []string) string { return regional(loc, "kinesis", "stream/"+v[0]) },
+	},
+	{
+		dimensions: []string{"CacheClusterId"},
+		arn:        func(loc Location, v []string) string { return regional(loc, "elasticache", "cluster:"+v[0]) },
+	},
+	{
+		dimensions: []string{"StateMachineArn"},
+		arn:        func(_ Location, v []string) string { return v[0] },
+	},
+}
+
+// ResourceARN returns the ARN of the resource a metric with the given namespace and dimensions
+// describes, or false when none of the well-known dimensions is present.
+func ResourceARN(loc Location, namespace string, dimensions map[string]string) (string, bool) {
+	for _, rule := range resourceRules {
+		if len(rule.namespaces) > 0 && !slices.Contains(rule.namespaces, namespace) {
+			continue
+		}
+
+		values, ok := dimensionValues(dimensions, rule.dimensions)
+		if !ok {
+			continue
+		}
+
+		return rule.arn(loc, values), true
+	}
+
+	return "", false
+}
+
+func dimensionValues(dimensions map[string]string, names []string) ([]string, bool) {
+	values := make([]string, len(names))
+	for i, name := range names {
+		v := dimensions[name]
+		if v == "" {
+			return nil, false
+		}
+		values[i] = v
+	}
+	return values, true
+}
+
+func regional(loc Location, service, resource string) string {
+	return "arn:" + loc.Partition + ":" + service + ":" + loc.Region + ":" + loc.AccountID + ":" + resource
+}
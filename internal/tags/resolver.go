@@ -0,0 +1,146 @@
+// Package tags resolves the tags of the resources behind CloudWatch metrics.
+package tags
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+var tracer = otel.Tracer("github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/tags")
+
+// maxARNsPerRequest is the GetResources limit on the number of ARNs per request.
+const maxARNsPerRequest = 100
+
+// DefaultKeys are the tags attached to violating metrics unless configured otherwise.
+var DefaultKeys = []string{"Name", "Team", "Owner", "Environment"}
+
+// TaggingAPI defines the Resource Groups Tagging operations required for tag resolution.
+type TaggingAPI interface {
+	GetResources(
+		ctx context.Context,
+		input *resourcegroupstaggingapi.GetResourcesInput,
+		optFns ...func(*resourcegroupstaggingapi.Options)) (*resourcegroupstaggingapi.GetResourcesOutput, error)
+}
+
+// ClientProvider returns the tagging client for an account and region.
+type ClientProvider interface {
+	Client(ctx context.Context, accountID, region string) (TaggingAPI, error)
+}
+
+// Resolver attaches the tags of their resources to violating metrics.
+type Resolver struct {
+	clients       ClientProvider
+	defaultRegion string
+	keys          []string
+}
+
+// NewResolver creates a Resolver that attaches the given tag keys. defaultRegion is used to build
+// ARNs for alarms whose region is not known.
+func NewResolver(clients ClientProvider, defaultRegion string, keys []string) *Resolver {
+	return &Resolver{
+		clients:       clients,
+		defaultRegion: defaultRegion,
+		keys:          keys,
+	}
+}
+
+// Resolve maps the violating metrics of an alarm in the given namespace to resource ARNs and
+// attaches the configured tags of those resources. Metrics are updated in place; those without
+// a well-known resource dimension are left untouched.
+func (r *Resolver) Resolve(
+	ctx context.Context,
+	accountID, region, namespace string,
+	metrics []events.ViolatingMetric,
+) error {
+	if len(metrics) == 0 || accountID == "" {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, "tags.resolve")
+	defer span.End()
+
+	if region == "" {
+		region = r.defaultRegion
+	}
+
+	loc := Location{Partition: PartitionForRegion(region), AccountID: accountID, Region: region}
+
+	var arns []string
+	seen := make(map[string]bool)
+	for i := range metrics {
+		arn, ok := ResourceARN(loc, namespace, metrics[i].Dimensions)
+		if !ok {
+			continue
+		}
+
+		metrics[i].ResourceARN = arn
+		if !seen[arn] {
+			seen[arn] = true
+			arns = append(arns, arn)
+		}
+	}
+
+	span.SetAttributes(attribute.Int("tags.resource_count", len(arns)))
+
+	if len(arns) == 0 {
+		return nil
+	}
+
+	client, err := r.clients.Client(ctx, accountID, region)
+	if err != nil {
+		return fmt.Errorf("cannot get tagging client for account %s in %s: %w", accountID, region, err)
+	}
+
+	resourceTags, err := r.getTags(ctx, client, arns)
+	if err != nil {
+		return err
+	}
+
+	for i := range metrics {
+		if t := resourceTags[metrics[i].ResourceARN]; len(t) > 0 {
+			metrics[i].Tags = t
+		}
+	}
+
+	return nil
+}
+
+// getTags fetches the configured tags of the given resources in batches, keyed by ARN.
+func (r *Resolver) getTags(ctx context.Context, client TaggingAPI, arns []string) (map[string]map[string]string, error) {
+	resourceTags := make(map[string]map[string]string, len(arns))
+
+	for i := 0; i < len(arns); i += maxARNsPerRequest {
+		end := min(i+maxARNsPerRequest, len(arns))
+
+		paginator := resourcegroupstaggingapi.NewGetResourcesPaginator(client, &resourcegroupstaggingapi.GetResourcesInput{
+			ResourceARNList: arns[i:end],
+		})
+
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get resource tags on next page: %w", err)
+			}
+
+			for _, mapping := range page.ResourceTagMappingList {
+				selected := make(map[string]string)
+				for _, tag := range mapping.Tags {
+					if key := aws.ToString(tag.Key); slices.Contains(r.keys, key) {
+						selected[key] = aws.ToString(tag.Value)
+					}
+				}
+				resourceTags[aws.ToString(mapping.ResourceARN)] = selected
+			}
+		}
+	}
+
+	return resourceTags, nil
+}
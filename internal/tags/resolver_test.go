@@ -0,0 +1,150 @@
+package tags
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ab0utbla-k/cloudwatch-alarm-enricher/internal/events"
+)
+
+// fakeTagging returns a Name tag and an unselected tag for every requested ARN.
+type fakeTagging struct {
+	requests [][]string
+}
+
+func (f *fakeTagging) GetResources(
+	_ context.Context,
+	input *resourcegroupstaggingapi.GetResourcesInput,
+	_ ...func(*resourcegroupstaggingapi.Options),
+) (*resourcegroupstaggingapi.GetResourcesOutput, error) {
+	f.requests = append(f.requests, input.ResourceARNList)
+
+	output := &resourcegroupstaggingapi.GetResourcesOutput{}
+	for _, arn := range input.ResourceARNList {
+		output.ResourceTagMappingList = append(output.ResourceTagMappingList, types.ResourceTagMapping{
+			ResourceARN: aws.String(arn),
+			Tags: []types.Tag{
+				{Key: aws.String("Name"), Value: aws.String("name-of-" + arn)},
+				{Key: aws.String("CostCenter"), Value: aws.String("42")},
+			},
+		})
+	}
+	return output, nil
+}
+
+type fakeClients struct {
+	client TaggingAPI
+}
+
+func (f fakeClients) Client(context.Context, string, string) (TaggingAPI, error) {
+	return f.client, nil
+}
+
+func TestResourceARN(t *testing.T) {
+	loc := Location{Partition: "aws", AccountID: "111111111111", Region: "eu-west-1"}
+
+	tests := []struct {
+		name       string
+		namespace  string
+		dimensions map[string]string
+		want       string
+	}{
+		{
+			name:       "ec2 instance",
+			namespace:  "AWS/EC2",
+			dimensions: map[string]string{"InstanceId": "i-0abc"},
+			want:       "arn:aws:ec2:eu-west-1:111111111111:instance/i-0abc",
+		},
+		{
+			name:       "rds instance",
+			namespace:  "AWS/RDS",
+			dimensions: map[string]string{"DBInstanceIdentifier": "orders"},
+			want:       "arn:aws:rds:eu-west-1:111111111111:db:orders",
+		},
+		{
+			name:       "application load balancer",
+			namespace:  "AWS/ApplicationELB",
+			dimensions: map[string]string{"LoadBalancer": "app/web/50dc6c495c0c9188"},
+			want:       "arn:aws:elasticloadbalancing:eu-west-1:111111111111:loadbalancer/app/web/50dc6c495c0c9188",
+		},
+		{
+			name:      "target group wins over load balancer",
+			namespace: "AWS/ApplicationELB",
+			dimensions: map[string]string{
+				"LoadBalancer": "app/web/50dc6c495c0c9188",
+				"TargetGroup":  "targetgroup/api/73e2d6bc24d8a067",
+			},
+			want: "arn:aws:elasticloadbalancing:eu-west-1:111111111111:targetgroup/api/73e2d6bc24d8a067",
+		},
+		{
+			name:       "lambda alias",
+			namespace:  "AWS/Lambda",
+			dimensions: map[string]string{"FunctionName": "checkout:live", "Resource": "checkout:live"},
+			want:       "arn:aws:lambda:eu-west-1:111111111111:function:checkout",
+		},
+		{
+			name:       "ecs service",
+			namespace:  "AWS/ECS",
+			dimensions: map[string]string{"ClusterName": "prod", "ServiceName": "api"},
+			want:       "arn:aws:ecs:eu-west-1:111111111111:service/prod/api",
+		},
+		{
+			name:       "sqs queue",
+			namespace:  "AWS/SQS",
+			dimensions: map[string]string{"QueueName": "jobs"},
+			want:       "arn:aws:sqs:eu-west-1:111111111111:jobs",
+		},
+		{
+			name:       "cluster name outside ecs",
+			namespace:  "ContainerInsights",
+			dimensions: map[string]string{"ClusterName": "prod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arn, ok := ResourceARN(loc, tt.namespace, tt.dimensions)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, arn)
+		})
+	}
+}
+
+func TestPartitionForRegion(t *testing.T) {
+	assert.Equal(t, "aws", PartitionForRegion("eu-west-1"))
+	assert.Equal(t, "aws-cn", PartitionForRegion("cn-north-1"))
+	assert.Equal(t, "aws-us-gov", PartitionForRegion("us-gov-west-1"))
+}
+
+func TestResolve(t *testing.T) {
+	tagging := &fakeTagging{}
+	resolver := NewResolver(fakeClients{client: tagging}, "eu-west-1", DefaultKeys)
+
+	metrics := make([]events.ViolatingMetric, 0, 151)
+	for i := range 150 {
+		metrics = append(metrics, events.ViolatingMetric{
+			Dimensions: map[string]string{"InstanceId": fmt.Sprintf("i-%d", i)},
+		})
+	}
+	metrics = append(metrics, events.ViolatingMetric{Dimensions: map[string]string{"Unknown": "x"}})
+
+	err := resolver.Resolve(context.Background(), "111111111111", "", "AWS/EC2", metrics)
+	require.NoError(t, err)
+
+	require.Len(t, tagging.requests, 2)
+	assert.Len(t, tagging.requests[0], maxARNsPerRequest)
+	assert.Len(t, tagging.requests[1], 50)
+
+	arn := "arn:aws:ec2:eu-west-1:111111111111:instance/i-0"
+	assert.Equal(t, arn, metrics[0].ResourceARN)
+	assert.Equal(t, map[string]string{"Name": "name-of-" + arn}, metrics[0].Tags)
+	assert.Empty(t, metrics[150].ResourceARN)
+	assert.Nil(t, metrics[150].Tags)
+}